@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd, see sd_listen_fds(3).
+const listenFDsStart = 3
+
+// activatedListeners returns the listening sockets passed by systemd with
+// socket activation, by the names given by FileDescriptorName= of the socket
+// units. The environment variables telling about them get unset, so that
+// they do not get passed on to child processes.
+func activatedListeners() (map[string]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := map[string]net.Listener{}
+	for i := 0; i < n; i++ {
+		// Named so by systemd unless given
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		// The listener has a duplicate of its own
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %s passed by systemd: %s", name, err)
+		}
+		if _, ok := listeners[name]; ok {
+			return nil, fmt.Errorf("more than one socket named %s passed by systemd", name)
+		}
+		listeners[name] = l
+	}
+	return listeners, nil
+}
+
+// serverListeners hands out the listeners of the server, those passed by
+// systemd first.
+type serverListeners struct {
+	activated map[string]net.Listener
+}
+
+// Activated returns whether systemd passed a socket named name.
+func (s *serverListeners) Activated(name string) bool {
+	_, ok := s.activated[name]
+	return ok
+}
+
+// Listen returns the socket named name passed by systemd, or otherwise
+// listens on addr. A single socket named otherwise is taken for HTTP, as
+// named after its unit by default.
+func (s *serverListeners) Listen(name, addr string) (net.Listener, error) {
+	if name == "http" && len(s.activated) == 1 && !s.Activated("grpc") && !s.Activated("ssh") {
+		for other := range s.activated {
+			name = other
+		}
+	}
+	if l, ok := s.activated[name]; ok {
+		delete(s.activated, name)
+		return l, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Unused fails for sockets passed by systemd that the server has no use for.
+func (s *serverListeners) Unused() error {
+	names := []string{}
+	for name, l := range s.activated {
+		l.Close()
+		names = append(names, name)
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return fmt.Errorf("sockets passed by systemd are none of http, grpc and ssh: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
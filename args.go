@@ -0,0 +1,24 @@
+package main
+
+import "github.com/icedream/gobfy/bf"
+
+// encodeArgs joins args with each one terminated by a NUL byte.
+func encodeArgs(args []string) []byte {
+	encoded := []byte{}
+	for _, arg := range args {
+		encoded = append(append(encoded, arg...), 0)
+	}
+	return encoded
+}
+
+// writeArgsToTape stores the encoded args in the data cells starting at
+// the first one, leaving the data pointer where it is. Call it once the
+// program is loaded, failing like the program would if the data cells can
+// not hold them.
+func writeArgsToTape(p *bf.Processor, args []string) error {
+	pointer := p.DataPointer
+	p.DataPointer = 0
+	err := p.WriteCells(encodeArgs(args))
+	p.DataPointer = pointer
+	return err
+}
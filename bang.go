@@ -0,0 +1,14 @@
+package main
+
+import "bytes"
+
+// splitBangInput splits source at the first "!", following the convention
+// of appending a program's input to its source. Returns nil as input if
+// there is no "!".
+func splitBangInput(source []byte) (code, input []byte) {
+	i := bytes.IndexByte(source, '!')
+	if i < 0 {
+		return source, nil
+	}
+	return source[:i], source[i+1:]
+}
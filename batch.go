@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Extensions of source files picked up by batch.
+var batchExtensions = []string{".b", ".bf"}
+
+type batchResult struct {
+	Name    string
+	Steps   uint64
+	Elapsed time.Duration
+	Output  int
+	Err     error
+}
+
+// batchPrograms returns the source files in dir, sorted by name.
+func batchPrograms(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		for _, ext := range batchExtensions {
+			if filepath.Ext(entry.Name()) == ext {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// runBatchProgram executes the program at path with input from the file
+// next to it with extension .in, if any, and writes its output to the file
+// with extension .out.
+func runBatchProgram(path string) batchResult {
+	result := batchResult{Name: filepath.Base(path)}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+
+	embeddedInput = nil
+	source, err := loadSource(path)
+	if err == nil && *flagStrict {
+		if err = checkStrict(source); err != nil {
+			err = fmt.Errorf("%s:%s", path, err)
+		}
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	input := embeddedInput
+	if input == nil {
+		input, err = ioutil.ReadFile(base + ".in")
+		if err != nil && !os.IsNotExist(err) {
+			result.Err = err
+			return result
+		}
+	}
+
+	var output bytes.Buffer
+	p := newProcessor()
+	p.Stdin(bytes.NewReader(input))
+	p.Stdout(&output)
+	p.Load(source)
+
+	start := time.Now()
+	err = p.Execute()
+	if err == nil {
+		err = p.ExpectEnd()
+	}
+	if err == nil {
+		err = p.Flush()
+	}
+	result.Elapsed = time.Since(start)
+	result.Steps = p.Steps()
+	result.Output = output.Len()
+	result.Err = err
+
+	if err := ioutil.WriteFile(base+".out", output.Bytes(), 0666); err != nil && result.Err == nil {
+		result.Err = err
+	}
+	return result
+}
+
+// writeBatchSummary prints a table of the results to w.
+func writeBatchSummary(w io.Writer, results []batchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROGRAM\tSTEPS\tTIME\tOUTPUT\tSTATUS")
+
+	failed := 0
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = "error: " + result.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d B\t%s\n",
+			result.Name, result.Steps, result.Elapsed.Round(time.Microsecond), result.Output, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%d programs, %d ok, %d failed\n", len(results), len(results)-failed, failed)
+	return err
+}
+
+// batch runs all programs in dir and prints a summary to standard output.
+// Returns whether all of them halted without errors.
+func batch(dir string) (bool, error) {
+	paths, err := batchPrograms(dir)
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	results := []batchResult{}
+	for _, path := range paths {
+		result := runBatchProgram(path)
+		if result.Err != nil {
+			ok = false
+		}
+		results = append(results, result)
+	}
+
+	return ok, writeBatchSummary(os.Stdout, results)
+}
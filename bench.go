@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+// bench executes the program the given number of times, each run reading the
+// same input captured up front unless it is random, and prints timing
+// statistics to standard error, along with the output throughput for
+// programs writing output. Standard input is only read for programs reading
+// input, so that benchmarks can run with it left open.
+func bench(source []byte, runs int) {
+	if runs < 1 {
+		log.Fatal("need at least one run")
+	}
+
+	// Random input is endless, each run gets a stream of its own instead,
+	// the same one if seeded
+	random := isRandomInput(*flagInput)
+	if random {
+		if _, err := programInput(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	var input []byte
+	if !random && (*flagInput != "" || bytes.IndexByte(source, ',') >= 0) {
+		r, err := programInput()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if r != io.Reader(os.Stdin) || !isTerminal(os.Stdin) {
+			if input, err = ioutil.ReadAll(r); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	var total, min, max time.Duration
+	var steps uint64
+	var output countingWriter
+	for i := 0; i < runs; i++ {
+		p := newProcessor()
+		p.Stdin(bytes.NewReader(input))
+		if random {
+			r, err := programInput()
+			if err != nil {
+				log.Fatal(err)
+			}
+			p.Stdin(r)
+		}
+		output = 0
+		p.Stdout(&output)
+		p.Load(source)
+
+		start := time.Now()
+		err := p.Execute()
+		elapsed := time.Since(start)
+		if err == nil {
+			err = p.ExpectEnd()
+		}
+		if err != nil {
+			log.Fatalf("run %d: %s", i+1, err)
+		}
+
+		total += elapsed
+		if i == 0 || elapsed < min {
+			min = elapsed
+		}
+		if elapsed > max {
+			max = elapsed
+		}
+		steps = p.Steps()
+	}
+
+	mean := total / time.Duration(runs)
+	fmt.Fprintf(os.Stderr, "%d runs, %d steps each\nmin %s, mean %s, max %s\n%.0f steps/s\n",
+		runs, steps, min, mean, max, float64(steps)/mean.Seconds())
+	if output > 0 {
+		fmt.Fprintf(os.Stderr, "%d bytes of output each, %.1f MB/s\n", output, float64(output)/mean.Seconds()/1e6)
+	}
+}
+
+// countingWriter discards what gets written to it, counting the bytes.
+type countingWriter int64
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	*c += countingWriter(len(b))
+	return len(b), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// BenchmarkExamples executes each example program the way the bench command
+// does, with its output discarded.
+func BenchmarkExamples(b *testing.B) {
+	input := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog.\n"), 4)
+	for _, name := range exampleNames() {
+		source, err := exampleSource(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			var output countingWriter
+			for i := 0; i < b.N; i++ {
+				p := bf.NewProcessor()
+				// Like for the run command, examples expect the end of
+				// input to leave the cell unchanged
+				p.EOF = bf.EOFUnchanged
+				p.Stdin(bytes.NewReader(input))
+				p.Stdout(&output)
+				p.Load(source)
+				if err := p.Execute(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.SetBytes(int64(output) / int64(b.N))
+		})
+	}
+}
+
+// BenchmarkLoops measures tight loops, which dominate most programs.
+func BenchmarkLoops(b *testing.B) {
+	// Counts a cell down 255 times for each of 255 counts of its neighbour
+	source := []byte("-[>-[-]<-]")
+	for i := 0; i < b.N; i++ {
+		p := bf.NewProcessor()
+		p.Stdout(ioutil.Discard)
+		p.Load(source)
+		if err := p.Execute(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package bf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Frame is an entry of the call stack kept for extensions running nested
+// code, such as eval.
+type Frame struct {
+	// Name of the code called, such as the instruction's extension
+	Name string
+	// Offset of the calling instruction within the code of the frame below,
+	// or within the program for the outermost frame
+	CallSite int
+}
+
+// PushFrame records that the instruction currently being executed starts
+// running nested code called name, until the matching call to PopFrame.
+func (p *Processor) PushFrame(name string) {
+	p.frames = append(p.frames, Frame{Name: name, CallSite: p.instructionPointer})
+}
+
+// PopFrame removes the innermost frame pushed by PushFrame.
+func (p *Processor) PopFrame() {
+	p.frames = p.frames[:len(p.frames)-1]
+}
+
+// CallStack returns the frames of the nested code currently running,
+// outermost first. Empty while running the program itself.
+func (p *Processor) CallStack() []Frame {
+	return append([]Frame(nil), p.frames...)
+}
+
+// CallStackError is an error that happened within nested code, along with
+// the call stack at that point.
+type CallStackError struct {
+	Err   error
+	Stack []Frame
+}
+
+func (e *CallStackError) Error() string {
+	return fmt.Sprintf("%s\n%s", e.Err, FormatCallStack(e.Stack))
+}
+
+func (e *CallStackError) Unwrap() error {
+	return e.Err
+}
+
+// FormatCallStack renders stack as backtrace, innermost frame first.
+// Repeated frames, as for recursion, get collapsed.
+func FormatCallStack(stack []Frame) string {
+	var b strings.Builder
+	b.WriteString("call stack, innermost first:")
+	for i := len(stack) - 1; i >= 0; {
+		frame := stack[i]
+		repeated := 1
+		for i-repeated >= 0 && stack[i-repeated] == frame {
+			repeated++
+		}
+		i -= repeated
+
+		caller := "the program"
+		if i >= 0 {
+			caller = stack[i].Name
+		}
+		fmt.Fprintf(&b, "\n  %s called by %s at offset %d", frame.Name, caller, frame.CallSite)
+		if repeated > 1 {
+			fmt.Fprintf(&b, " (%d times)", repeated)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package bf
+
+import "fmt"
+
+// Device provides data cells backed by Go code, see Processor.MapDevice.
+type Device interface {
+	// ReadCell returns the value of the cell at offset from the start of
+	// the device's cells, called before each instruction executed with
+	// the data pointer on it.
+	ReadCell(p *Processor, offset int) byte
+
+	// WriteCell is called whenever an instruction wrote value to the cell
+	// at offset from the start of the device's cells.
+	WriteCell(p *Processor, offset int, value byte)
+}
+
+type mappedDevice struct {
+	start, size int
+	device      Device
+}
+
+// MapDevice hands the size data cells starting at start over to device.
+// Fails if any of them is already mapped to another device.
+func (p *Processor) MapDevice(start, size int, device Device) error {
+	if start < 0 || size < 1 {
+		return fmt.Errorf("invalid device cells %d to %d", start, start+size-1)
+	}
+	for _, d := range p.devices {
+		if start < d.start+d.size && d.start < start+size {
+			return fmt.Errorf("device cells %d to %d overlap with device at %d to %d",
+				start, start+size-1, d.start, d.start+d.size-1)
+		}
+	}
+
+	p.devices = append(p.devices, &mappedDevice{start, size, device})
+	return nil
+}
+
+func (p *Processor) deviceAt(pointer int) *mappedDevice {
+	for _, d := range p.devices {
+		if pointer >= d.start && pointer < d.start+d.size {
+			return d
+		}
+	}
+	return nil
+}
+
+func (p *Processor) readDevice() {
+	if d := p.deviceAt(p.DataPointer); d != nil {
+		p.Data[p.DataPointer] = d.device.ReadCell(p, p.DataPointer-d.start)
+	}
+}
+
+func (p *Processor) writeDevice() {
+	if d := p.deviceAt(p.DataPointer); d != nil {
+		d.device.WriteCell(p, p.DataPointer-d.start, p.Data[p.DataPointer])
+	}
+}
@@ -0,0 +1,34 @@
+package bf
+
+// Evaluate executes code to its end as nested code called name, then
+// continues with the program loaded before. Returns ErrHalted if code halted
+// the processor.
+func (p *Processor) Evaluate(name string, code []byte) error {
+	buffer, pointer := p.instructionBuffer, p.instructionPointer
+	closures, threads, hits := p.closures, p.threads, p.hits
+	selfModifying := p.SelfModifying
+	defer func() {
+		p.instructionBuffer, p.instructionPointer = buffer, pointer
+		p.closures, p.threads, p.hits = closures, threads, hits
+		p.SelfModifying = selfModifying
+	}()
+
+	p.PushFrame(name)
+	defer p.PopFrame()
+
+	p.instructionBuffer, p.instructionPointer = code, 0
+	p.closures = []*Closure{&Closure{Root: true}}
+	p.threads, p.hits = nil, nil
+	p.SelfModifying = false
+
+	err := p.Execute()
+	if err == nil {
+		if err = p.ExpectEnd(); err != nil {
+			err = &CallStackError{Err: err, Stack: p.CallStack()}
+		}
+	}
+	if err == nil && p.halted {
+		return ErrHalted
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package bf
+
+import "fmt"
+
+// EventKind tells what happened in an Event.
+type EventKind int
+
+const (
+	// An instruction got executed, delivered before it takes effect.
+	InstructionExecuted EventKind = iota
+	// The output instruction is about to write Value.
+	OutputByte
+	// The input instruction is about to read.
+	InputRequested
+	// A loop got entered rather than skipped.
+	LoopEntered
+	// Execution of the program ended, with Err telling why unless it
+	// halted normally.
+	Halted
+)
+
+var eventKindNames = []string{"instruction", "output", "input", "loop", "halted"}
+
+func (k EventKind) String() string {
+	if int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+func (k EventKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Event describes something happening during execution, along with the
+// state of the processor at that point.
+type Event struct {
+	Kind               EventKind `json:"kind"`
+	Step               uint64    `json:"step"`
+	InstructionPointer int       `json:"ip"`
+	Instruction        byte      `json:"instruction,omitempty"`
+	DataPointer        int       `json:"dp"`
+	// Value of the current data cell, or the byte written for OutputByte
+	Value byte  `json:"value"`
+	Err   error `json:"-"`
+}
+
+// Subscribe makes handler get called with each event during execution.
+// Handlers run on the goroutine executing the program, and hold it up
+// until they return.
+func (p *Processor) Subscribe(handler func(e Event)) {
+	if len(p.subscribers) == 0 {
+		p.OnStep(func(p *Processor) {
+			p.emit(InstructionExecuted, nil)
+		})
+	}
+	p.subscribers = append(p.subscribers, handler)
+}
+
+func (p *Processor) emit(kind EventKind, err error) {
+	e := Event{
+		Kind:               kind,
+		Step:               p.steps,
+		InstructionPointer: p.instructionPointer,
+		DataPointer:        p.DataPointer,
+		Err:                err,
+	}
+	if p.instructionPointer < len(p.instructionBuffer) {
+		e.Instruction = p.instructionBuffer[p.instructionPointer]
+	}
+	if p.DataPointer < len(p.Data) {
+		e.Value = p.Data[p.DataPointer]
+	}
+	for _, handler := range p.subscribers {
+		handler(e)
+	}
+}
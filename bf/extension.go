@@ -0,0 +1,55 @@
+package bf
+
+import (
+	"sort"
+	"sync"
+)
+
+// Extension adds instructions to the processor.
+type Extension struct {
+	Name        string
+	Description string
+
+	// New returns the implementation of each instruction added by the
+	// extension, with state of its own for use by a single processor. Fails
+	// if the extension's options are invalid.
+	New func() (map[byte]func(p *Processor) error, error)
+}
+
+var (
+	extensionsMu sync.RWMutex
+	extensions   = map[string]*Extension{}
+)
+
+// RegisterExtension makes ext available by its name through
+// LookupExtension, for extensions living outside of the interpreter. Call it
+// from an init function. Panics if an extension with the same name is
+// already registered.
+func RegisterExtension(ext *Extension) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	if _, ok := extensions[ext.Name]; ok {
+		panic("extension " + ext.Name + " registered twice")
+	}
+	extensions[ext.Name] = ext
+}
+
+// LookupExtension returns the registered extension with the given name.
+func LookupExtension(name string) (*Extension, bool) {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+	ext, ok := extensions[name]
+	return ext, ok
+}
+
+// ExtensionNames returns the names of all registered extensions, sorted.
+func ExtensionNames() []string {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+	names := []string{}
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,56 @@
+package bf
+
+import "fmt"
+
+// HostFunction is a Go function callable by programs using the ffi
+// extension.
+type HostFunction struct {
+	Name string
+	// Number of cells right of the current one passed as arguments, and
+	// number of cells written back there as results
+	Args, Results int
+	// Call returns the results for args. It may return fewer results than
+	// declared, the remaining cells are set to zero.
+	Call func(args []byte) ([]byte, error)
+}
+
+// RegisterFunction makes fn callable by the ffi extension's instruction
+// while the current cell holds index, replacing any function registered
+// with the same index before.
+func (p *Processor) RegisterFunction(index byte, fn *HostFunction) {
+	if p.functions == nil {
+		p.functions = map[byte]*HostFunction{}
+	}
+	p.functions[index] = fn
+}
+
+// CallFunction calls the host function selected by the current cell with
+// the cells right of it as arguments, and writes its results there.
+func (p *Processor) CallFunction() error {
+	index := p.Current()
+	fn, ok := p.functions[index]
+	if !ok {
+		return fmt.Errorf("no host function registered with index %d", index)
+	}
+
+	args := make([]byte, fn.Args)
+	for i := range args {
+		if offset := p.DataPointer + 1 + i; offset < len(p.Data) {
+			args[i] = p.Data[offset]
+		}
+	}
+	results, err := fn.Call(args)
+	if err != nil {
+		return fmt.Errorf("host function %s: %s", fn.Name, err)
+	}
+	if len(results) > fn.Results {
+		return fmt.Errorf("host function %s: returned %d results, declared %d", fn.Name, len(results), fn.Results)
+	}
+
+	pointer := p.DataPointer
+	p.DataPointer++
+	defer func() {
+		p.DataPointer = pointer
+	}()
+	return p.WriteCells(append(results, make([]byte, fn.Results-len(results))...))
+}
@@ -0,0 +1,74 @@
+package bf
+
+import "io"
+
+const inputBufferSize = 4096
+
+// inputReader buffers the input of a processor, like bufio.Reader does.
+type inputReader struct {
+	r          io.Reader
+	buf        []byte
+	start, end int
+	err        error
+}
+
+func newInputReader(r io.Reader) *inputReader {
+	return &inputReader{r: r, buf: make([]byte, inputBufferSize)}
+}
+
+// Buffered returns the number of bytes that can be read without reading
+// from the underlying reader.
+func (r *inputReader) Buffered() int {
+	return r.end - r.start
+}
+
+// fill reads into the buffer once it has been read completely, retrying
+// readers returning nothing a few times like bufio.Reader does.
+func (r *inputReader) fill() {
+	r.start, r.end = 0, 0
+	for i := 0; i < 100 && r.end == 0 && r.err == nil; i++ {
+		r.end, r.err = r.r.Read(r.buf)
+	}
+	if r.end == 0 && r.err == nil {
+		r.err = io.ErrNoProgress
+	}
+}
+
+// readErr returns the error the underlying reader failed with, and forgets
+// about it for the next read, as the reader may have input again later.
+func (r *inputReader) readErr() error {
+	err := r.err
+	r.err = nil
+	return err
+}
+
+func (r *inputReader) ReadByte() (byte, error) {
+	if r.start == r.end {
+		r.fill()
+		if r.start == r.end {
+			return 0, r.readErr()
+		}
+	}
+	b := r.buf[r.start]
+	r.start++
+	return b, nil
+}
+
+func (r *inputReader) Read(b []byte) (int, error) {
+	if r.start == r.end {
+		r.fill()
+		if r.start == r.end {
+			return 0, r.readErr()
+		}
+	}
+	n := copy(b, r.buf[r.start:r.end])
+	r.start += n
+	return n, nil
+}
+
+// eofReader is the input of processors not given any.
+type eofReader struct{}
+
+func (eofReader) Read(b []byte) (int, error) {
+	return 0, io.EOF
+}
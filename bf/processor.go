@@ -0,0 +1,795 @@
+// Package bf is the engine executing Brainfuck programs in gobfy. It only
+// uses the io interfaces it is given for input, output and the debug log, and
+// none of os, bufio or log, so that it can be embedded anywhere down to
+// microcontrollers with TinyGo.
+package bf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+const (
+	InstMoveRight byte = '>'
+	InstMoveLeft       = '<'
+	InstIncrement      = '+'
+	InstDecrement      = '-'
+	InstOutput         = '.'
+	InstInput          = ','
+	InstLoopStart      = '['
+	InstLoopEnd        = ']'
+)
+
+const (
+	DefaultPageSize = 1024
+)
+
+const (
+	DebugLevelLoops = 1 + iota
+	DebugLevelInstructions
+	DebugLevelTape
+)
+
+// What the input instruction does once there is no more input.
+const (
+	// Fail execution with io.EOF.
+	EOFError = iota
+	// Set the current data cell to 0.
+	EOFZero
+	// Set the current data cell to 255.
+	EOFMax
+	// Leave the current data cell unchanged.
+	EOFUnchanged
+)
+
+var (
+	ErrInterrupted = errors.New("interrupted")
+
+	// ErrHalted can be returned by instructions of extensions to end the
+	// program early, Execute then returns nil.
+	ErrHalted = errors.New("halted")
+
+	ErrPointerUnderflow = errors.New("can not move data pointer left, already at beginning of data")
+
+	// ErrNoInput can be returned by readers given to Stdin if no input is
+	// available right now, the input instruction then sets the current cell
+	// to NoInput instead of waiting.
+	ErrNoInput = errors.New("no input available")
+
+	// ErrDataLimit is returned if the data cells would grow beyond MaxData.
+	ErrDataLimit = errors.New("data cells exceed limit")
+)
+
+type Closure struct {
+	Skip  bool
+	Root  bool
+	Start int
+}
+
+type Processor struct {
+	Data        []byte
+	DataPointer int
+
+	// MaxData is the most data cells to allocate, 0 for no limit, counting
+	// all cells returned by DataCells. Moving the data pointer beyond fails
+	// with ErrDataLimit.
+	MaxData int
+	// Cells of extensions' tapes other than Data, see NewData
+	otherData int
+
+	// DebugLevel selects how much detail to log about execution, see the
+	// DebugLevel* constants.
+	DebugLevel int
+
+	// DebugLog receives the debug log selected by DebugLevel, which is not
+	// logged anywhere if nil.
+	DebugLog DebugLogger
+
+	// CountHits enables counting how often each instruction gets executed.
+	// Needs to be set before calling Load.
+	CountHits bool
+
+	// CountWrites enables counting how often each data cell gets written to.
+	CountWrites bool
+
+	// SelfModifying places the program in the data cells before the one the
+	// data pointer starts at, so that it can modify itself. Execution ends
+	// at the first data cell holding 0 that the instruction pointer reaches.
+	// Needs to be set before calling Load.
+	SelfModifying bool
+
+	// EOF selects what the input instruction does at the end of input, see
+	// the EOF* constants.
+	EOF int
+
+	// NoInput is what the input instruction sets the current cell to if
+	// there is no input available, see ErrNoInput.
+	NoInput byte
+
+	// ByteOutput makes the output instruction write the current cell as a
+	// byte, instead of as UTF-8 encoded character of ISO 8859-1.
+	ByteOutput bool
+
+	// BitCells makes data cells hold single bits as in Boolfuck: increment
+	// and decrement flip the current cell, and input and output transfer
+	// single bits, least significant bit of each byte first. Call Flush at
+	// the end to write out the bits of an incomplete byte.
+	BitCells bool
+
+	stdin  *inputReader
+	stdout io.Writer
+
+	// Bits left of the current input byte and collected for the next output
+	// byte with BitCells
+	inBits, outBits         byte
+	inBitsLeft, outBitCount int
+
+	instructionPointer int
+	instructionBuffer  []byte
+
+	closures []*Closure
+
+	hits   []uint64
+	writes []uint64
+
+	steps     uint64
+	stepHooks []func(p *Processor)
+
+	inputHooks     []func(p *Processor, b byte, err error)
+	inputWaitHooks []func(p *Processor)
+
+	stopRequested int32
+
+	// Instructions added by extensions
+	extensionOps map[byte]func(p *Processor) error
+	halted       bool
+
+	// Suspended threads, in the order they get to continue
+	threads []*thread
+
+	devices []*mappedDevice
+
+	// Nested code running, see PushFrame
+	frames []Frame
+
+	// See Subscribe
+	subscribers []func(e Event)
+
+	// Called for errors of instructions, see Trap
+	trap     func(p *Processor, fault error) error
+	trapping bool
+
+	// Go functions callable by the ffi extension, by index
+	functions map[byte]*HostFunction
+
+	// Reused for the bytes written by output instructions
+	output []byte
+}
+
+// DebugLogger logs execution in as much detail as selected by DebugLevel.
+type DebugLogger interface {
+	// LogInstruction is called before executing each instruction with
+	// DebugLevelInstructions.
+	LogInstruction(p *Processor)
+	// LogLoop is called with DebugLevelLoops as the loop at the current
+	// instruction gets entered, skipped or exited, given as event "enter",
+	// "skip" or "exit".
+	LogLoop(p *Processor, event string)
+}
+
+// IsInstruction reports whether b is one of the standard instructions.
+func IsInstruction(b byte) bool {
+	switch b {
+	case InstMoveRight, InstMoveLeft, InstIncrement, InstDecrement,
+		InstOutput, InstInput, InstLoopStart, InstLoopEnd:
+		return true
+	}
+	return false
+}
+
+// NewProcessor returns a processor without any input, discarding its
+// output until given streams by Stdin and Stdout.
+func NewProcessor() *Processor {
+	return &Processor{
+		Data:   make([]byte, DefaultPageSize),
+		stdin:  newInputReader(eofReader{}),
+		stdout: io.Discard,
+		closures: []*Closure{
+			&Closure{Root: true},
+		},
+		instructionBuffer: []byte{},
+	}
+}
+
+// Stdin makes the input instruction read from r, which gets buffered unless
+// returned by Streams.
+func (p *Processor) Stdin(r io.Reader) {
+	if input, ok := r.(*inputReader); ok {
+		p.stdin = input
+		return
+	}
+	p.stdin = newInputReader(r)
+}
+
+// Stdout makes the output instruction write to w.
+func (p *Processor) Stdout(w io.Writer) {
+	p.stdout = w
+}
+
+// Streams returns the input and output currently in use, for extensions
+// redirecting them to restore them. Input already buffered is kept when
+// passing stdin to Stdin.
+func (p *Processor) Streams() (stdin io.Reader, stdout io.Writer) {
+	return p.stdin, p.stdout
+}
+
+// EnsureDataSize grows the data cells to include the one at the data
+// pointer, failing with ErrDataLimit instead of growing beyond MaxData.
+func (p *Processor) EnsureDataSize() error {
+	if p.DataPointer >= len(p.Data) {
+		// What is left of MaxData for Data
+		limit := p.MaxData - p.DataCells() + len(p.Data)
+		if p.MaxData > 0 && p.DataPointer >= limit {
+			return ErrDataLimit
+		}
+		// Increase data array, lock to next page size
+		size := 1 + (1+(p.DataPointer/DefaultPageSize))*DefaultPageSize
+		if p.MaxData > 0 && size > limit {
+			size = limit
+		}
+		p.Data = append(p.Data, make([]byte, size-len(p.Data))...)
+	}
+	return nil
+}
+
+// DataCells returns the number of data cells allocated: those of Data, those
+// of extensions' other tapes set aside by SwapData, and one for each thread
+// besides the current one.
+func (p *Processor) DataCells() int {
+	return len(p.Data) + p.otherData + len(p.threads)
+}
+
+// NewData allocates up to n data cells for a tape of an extension, fewer if
+// MaxData leaves less room, and fails with ErrDataLimit if there is no room
+// for a single one. The cells count against MaxData from then on, swap them
+// in and out of Data with SwapData.
+func (p *Processor) NewData(n int) ([]byte, error) {
+	if room := p.MaxData - p.DataCells(); p.MaxData > 0 && n > room {
+		if room < 1 {
+			return nil, ErrDataLimit
+		}
+		n = room
+	}
+	p.otherData += n
+	return make([]byte, n), nil
+}
+
+// SwapData makes data the data cells in use with the data pointer at
+// pointer, for extensions switching between tapes. Returns the previous data
+// cells and data pointer, which keep counting against MaxData. data needs to
+// be returned by NewData or SwapData.
+func (p *Processor) SwapData(data []byte, pointer int) ([]byte, int) {
+	previous, previousPointer := p.Data, p.DataPointer
+	p.otherData += len(previous) - len(data)
+	p.Data, p.DataPointer = data, pointer
+	return previous, previousPointer
+}
+
+// CellWritten needs to be called after writing to the current data cell.
+func (p *Processor) CellWritten() {
+	if len(p.devices) > 0 {
+		p.writeDevice()
+	}
+
+	if !p.CountWrites {
+		return
+	}
+
+	if p.DataPointer >= len(p.writes) {
+		p.writes = append(p.writes, make([]uint64, 1+p.DataPointer-len(p.writes))...)
+	}
+	p.writes[p.DataPointer]++
+}
+
+// WriteCells stores values in the data cells starting at the current one,
+// leaving the data pointer where it is.
+func (p *Processor) WriteCells(values []byte) error {
+	pointer := p.DataPointer
+	defer func() {
+		p.DataPointer = pointer
+	}()
+	for i, value := range values {
+		p.DataPointer = pointer + i
+		if err := p.EnsureDataSize(); err != nil {
+			return err
+		}
+		p.Data[p.DataPointer] = value
+		p.CellWritten()
+	}
+	return nil
+}
+
+// Writes returns the write count for each data cell up to the highest cell
+// written to so far. Returns nil unless CountWrites is enabled.
+func (p *Processor) Writes() []uint64 {
+	return p.writes
+}
+
+func (p *Processor) Load(instructions []byte) {
+	p.instructionBuffer = instructions
+	p.instructionPointer = 0
+	if p.SelfModifying {
+		p.DataPointer = len(instructions)
+		// The program is not subject to MaxData
+		maxData := p.MaxData
+		p.MaxData = 0
+		p.EnsureDataSize()
+		p.MaxData = maxData
+		copy(p.Data, instructions)
+		p.instructionBuffer = p.Data
+	}
+	p.halted = false
+	p.threads = nil
+
+	if p.CountHits {
+		p.hits = make([]uint64, len(instructions))
+	}
+}
+
+// Instructions returns the program loaded, or the data cells for
+// SelfModifying.
+func (p *Processor) Instructions() []byte {
+	return p.instructionBuffer
+}
+
+// Hits returns the execution count for each byte of the loaded program.
+// Returns nil unless CountHits was enabled when loading the program.
+func (p *Processor) Hits() []uint64 {
+	return p.hits
+}
+
+// OnStep registers a function to be called before each instruction that
+// actually gets executed, that is neither a comment nor skipped over as part
+// of a loop that is not entered. Calling Stop from hook keeps the
+// instruction from executing, without counting it as step.
+func (p *Processor) OnStep(hook func(p *Processor)) {
+	p.stepHooks = append(p.stepHooks, hook)
+}
+
+// OnInput registers a function to be called whenever the input instruction
+// has read a byte b or failed to do so with err, which is io.EOF at the end of
+// input.
+func (p *Processor) OnInput(hook func(p *Processor, b byte, err error)) {
+	p.inputHooks = append(p.inputHooks, hook)
+}
+
+// OnInputWait registers a function to be called before the input
+// instruction reads from Stdin with nothing buffered, and so might block.
+func (p *Processor) OnInputWait(hook func(p *Processor)) {
+	p.inputWaitHooks = append(p.inputWaitHooks, hook)
+}
+
+// Extend adds the instructions of ext. Fails if any of them is already
+// taken, either by a standard instruction or by another extension.
+func (p *Processor) Extend(ext *Extension) error {
+	ops, err := ext.New()
+	if err != nil {
+		return fmt.Errorf("extension %s: %s", ext.Name, err)
+	}
+	for token := range ops {
+		if err := p.checkBindable(token); err != nil {
+			return fmt.Errorf("extension %s: %s", ext.Name, err)
+		}
+	}
+
+	for token, op := range ops {
+		p.Bind(token, op)
+	}
+	return nil
+}
+
+// Bind makes token an instruction running handler. Fails if token is
+// already taken, either by a standard instruction or by an extension.
+func (p *Processor) Bind(token byte, handler func(p *Processor) error) error {
+	if err := p.checkBindable(token); err != nil {
+		return err
+	}
+	if p.extensionOps == nil {
+		p.extensionOps = map[byte]func(p *Processor) error{}
+	}
+	p.extensionOps[token] = handler
+	return nil
+}
+
+func (p *Processor) checkBindable(token byte) error {
+	if IsInstruction(token) {
+		return fmt.Errorf("can not replace standard instruction %q", token)
+	}
+	if _, ok := p.extensionOps[token]; ok {
+		return fmt.Errorf("instruction %q is already taken by another extension", token)
+	}
+	return nil
+}
+
+// InstructionPointer returns the offset of the instruction currently being
+// executed.
+func (p *Processor) InstructionPointer() int {
+	return p.instructionPointer
+}
+
+// Jump moves the instruction pointer to offset, for instructions of
+// extensions taking up the code following them. Execution continues after
+// the instruction at offset.
+func (p *Processor) Jump(offset int) {
+	p.instructionPointer = offset
+}
+
+// Instruction returns the instruction currently being executed.
+func (p *Processor) Instruction() byte {
+	return p.instructionBuffer[p.instructionPointer]
+}
+
+// Steps returns the number of instructions executed so far, including the
+// one currently being executed when called from a step hook.
+func (p *Processor) Steps() uint64 {
+	return p.steps
+}
+
+// Stop makes Execute return ErrInterrupted before executing the next
+// instruction. It is safe to call Stop from another goroutine.
+func (p *Processor) Stop() {
+	atomic.StoreInt32(&p.stopRequested, 1)
+}
+
+func (p *Processor) Execute() error {
+	err := p.execute()
+	// Nested code, such as run by eval, is not the program halting
+	if len(p.subscribers) > 0 && len(p.frames) == 0 {
+		p.emit(Halted, err)
+	}
+	return err
+}
+
+func (p *Processor) execute() error {
+	for {
+		if p.SelfModifying {
+			// The data cells might have been reallocated
+			p.instructionBuffer = p.Data
+		}
+		if p.instructionPointer >= len(p.instructionBuffer) ||
+			p.SelfModifying && p.instructionBuffer[p.instructionPointer] == 0 {
+			if len(p.threads) == 0 {
+				break
+			}
+			if err := p.ExpectEnd(); err != nil {
+				return err
+			}
+			p.switchThread(true)
+			continue
+		}
+
+		if atomic.LoadInt32(&p.stopRequested) != 0 {
+			return ErrInterrupted
+		}
+
+		instruction := p.instructionBuffer[p.instructionPointer]
+
+		if p.DebugLevel >= DebugLevelInstructions && p.DebugLog != nil {
+			p.DebugLog.LogInstruction(p)
+		}
+
+		if p.hits != nil && !p.closures[0].Skip && p.instructionPointer < len(p.hits) {
+			p.hits[p.instructionPointer]++
+		}
+
+		op, isExtension := p.extensionOps[instruction]
+		if !p.closures[0].Skip && (IsInstruction(instruction) || isExtension) {
+			if len(p.devices) > 0 {
+				p.readDevice()
+			}
+			p.steps++
+			for _, hook := range p.stepHooks {
+				hook(p)
+			}
+			if len(p.stepHooks) > 0 && atomic.LoadInt32(&p.stopRequested) != 0 {
+				p.steps--
+				return ErrInterrupted
+			}
+		}
+
+		var err error
+		switch instruction {
+		case InstMoveRight:
+			err = p.MoveRight()
+		case InstMoveLeft:
+			err = p.MoveLeft()
+		case InstDecrement:
+			p.Decrement()
+		case InstIncrement:
+			p.Increment()
+		case InstInput:
+			err = p.Input()
+		case InstOutput:
+			err = p.Output()
+		case InstLoopStart:
+			p.StartLoop()
+		case InstLoopEnd:
+			err = p.EndLoop()
+		default:
+			if isExtension && !p.closures[0].Skip {
+				err = op(p)
+			}
+		}
+		if err == ErrHalted {
+			p.halted = true
+			return nil
+		}
+		if err != nil && !errors.Is(err, ErrInterrupted) && p.trap != nil {
+			err = p.handleFault(err)
+		}
+		if _, ok := err.(*CallStackError); !ok && err != nil && len(p.frames) > 0 {
+			err = &CallStackError{Err: err, Stack: p.CallStack()}
+		}
+		if err != nil {
+			return err
+		}
+
+		p.instructionPointer++
+		if len(p.threads) > 0 {
+			p.switchThread(false)
+		}
+	}
+
+	return nil
+}
+
+func (p *Processor) Current() byte {
+	return p.Data[p.DataPointer]
+}
+
+func (p *Processor) Increment() {
+	if p.closures[0].Skip {
+		return
+	}
+
+	if p.BitCells {
+		p.Data[p.DataPointer] ^= 1
+	} else {
+		p.Data[p.DataPointer]++
+	}
+	p.CellWritten()
+}
+
+func (p *Processor) Decrement() {
+	if p.closures[0].Skip {
+		return
+	}
+
+	if p.BitCells {
+		p.Data[p.DataPointer] ^= 1
+	} else {
+		p.Data[p.DataPointer]--
+	}
+	p.CellWritten()
+}
+
+func (p *Processor) MoveRight() error {
+	if p.closures[0].Skip {
+		return nil
+	}
+
+	p.DataPointer++
+	if err := p.EnsureDataSize(); err != nil {
+		p.DataPointer--
+		return err
+	}
+	return nil
+}
+
+func (p *Processor) MoveLeft() error {
+	if p.closures[0].Skip {
+		return nil
+	}
+
+	if p.DataPointer == 0 {
+		return ErrPointerUnderflow
+	}
+
+	p.DataPointer--
+	return nil
+}
+
+func (p *Processor) Output() error {
+	if p.closures[0].Skip {
+		return nil
+	}
+
+	if len(p.subscribers) > 0 {
+		p.emit(OutputByte, nil)
+	}
+
+	if p.BitCells {
+		p.outBits |= (p.Data[p.DataPointer] & 1) << p.outBitCount
+		p.outBitCount++
+		if p.outBitCount < 8 {
+			return nil
+		}
+		return p.Flush()
+	}
+
+	b := p.Data[p.DataPointer]
+	p.output = p.output[:0]
+	if p.ByteOutput || b < utf8.RuneSelf {
+		p.output = append(p.output, b)
+	} else {
+		p.output = append(p.output, 0xc0|b>>6, 0x80|b&0x3f)
+	}
+
+	// Write the same character for the output instructions following right
+	// away at once, unless something needs to see each of them executed
+	if count := p.outputRun(); count > 1 {
+		char := len(p.output)
+		for i := 1; i < count; i++ {
+			p.output = append(p.output, p.output[:char]...)
+		}
+		p.instructionPointer += count - 1
+		p.steps += uint64(count - 1)
+	}
+
+	_, err := p.stdout.Write(p.output)
+	return err
+}
+
+// outputRun returns how many output instructions in a row start at the
+// current one, or 1 if they need to be executed one by one.
+func (p *Processor) outputRun() int {
+	if len(p.stepHooks) > 0 || p.hits != nil || len(p.devices) > 0 ||
+		len(p.threads) > 0 || p.SelfModifying || p.DebugLevel >= DebugLevelInstructions {
+		return 1
+	}
+	count := 1
+	for p.instructionPointer+count < len(p.instructionBuffer) &&
+		p.instructionBuffer[p.instructionPointer+count] == InstOutput {
+		count++
+	}
+	return count
+}
+
+// Flush writes out the bits collected by output instructions with
+// BitCells, padded with zero bits to a full byte.
+func (p *Processor) Flush() error {
+	if p.outBitCount == 0 {
+		return nil
+	}
+	b := p.outBits
+	p.outBits, p.outBitCount = 0, 0
+	_, err := p.stdout.Write([]byte{b})
+	return err
+}
+
+func (p *Processor) Input() error {
+	if p.closures[0].Skip {
+		return nil
+	}
+
+	if len(p.subscribers) > 0 {
+		p.emit(InputRequested, nil)
+	}
+
+	var input byte
+	var err error
+	if p.BitCells {
+		input, err = p.readBit()
+	} else {
+		input, err = p.readInput()
+	}
+	if err == ErrNoInput {
+		input, err = p.NoInput, nil
+	}
+	if err == io.EOF && p.EOF != EOFError {
+		switch {
+		case p.EOF == EOFZero:
+			input = 0
+		case p.EOF == EOFMax && p.BitCells:
+			input = 1
+		case p.EOF == EOFMax:
+			input = 0xff
+		case p.EOF == EOFUnchanged:
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+	p.Data[p.DataPointer] = input
+	p.CellWritten()
+	return nil
+}
+
+// readInput reads the next byte from Stdin for the input instruction.
+func (p *Processor) readInput() (byte, error) {
+	if p.stdin.Buffered() == 0 {
+		for _, hook := range p.inputWaitHooks {
+			hook(p)
+		}
+	}
+	input, err := p.stdin.ReadByte()
+	for _, hook := range p.inputHooks {
+		hook(p, input, err)
+	}
+	return input, err
+}
+
+// readBit reads the next bit from Stdin for the input instruction with
+// BitCells.
+func (p *Processor) readBit() (byte, error) {
+	if p.inBitsLeft == 0 {
+		b, err := p.readInput()
+		if err != nil {
+			return 0, err
+		}
+		p.inBits, p.inBitsLeft = b, 8
+	}
+	bit := p.inBits & 1
+	p.inBits >>= 1
+	p.inBitsLeft--
+	return bit, nil
+}
+
+func (p *Processor) StartLoop() {
+	if p.DebugLevel >= DebugLevelLoops && p.DebugLog != nil && !p.closures[0].Skip {
+		if p.Data[p.DataPointer] == 0 {
+			p.DebugLog.LogLoop(p, "skip")
+		} else {
+			p.DebugLog.LogLoop(p, "enter")
+		}
+	}
+
+	if len(p.subscribers) > 0 && !p.closures[0].Skip && p.Data[p.DataPointer] != 0 {
+		p.emit(LoopEntered, nil)
+	}
+
+	p.closures = append([]*Closure{
+		&Closure{
+			Start: p.instructionPointer,
+			Skip:  p.Data[p.DataPointer] == 0,
+		},
+	}, p.closures...)
+}
+
+func (p *Processor) EndLoop() error {
+	if len(p.closures) <= 1 {
+		return errors.New("unexpected end of closure, not in any closure")
+	}
+
+	currentClosure := p.closures[0]
+
+	if !currentClosure.Skip {
+		if p.Data[p.DataPointer] > 0 {
+			p.instructionPointer = currentClosure.Start
+			return nil
+		}
+	}
+
+	if p.DebugLevel >= DebugLevelLoops && p.DebugLog != nil && !currentClosure.Skip {
+		p.DebugLog.LogLoop(p, "exit")
+	}
+
+	p.closures = p.closures[1:]
+	return nil
+}
+
+func (p *Processor) ExpectEnd() error {
+	if len(p.closures) > 1 && !p.halted {
+		return errors.New("unexpected end of instructions, still in a closure")
+	}
+	return nil
+}
+
+// ResetLoops drops the loops left open, as by a program that failed.
+func (p *Processor) ResetLoops() {
+	// The root closure is the last one
+	p.closures = p.closures[len(p.closures)-1:]
+}
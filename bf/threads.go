@@ -0,0 +1,70 @@
+package bf
+
+// thread holds the state of a suspended thread of execution. Threads share
+// the data cells and everything else of the processor.
+type thread struct {
+	dataPointer        int
+	instructionPointer int
+	closures           []*Closure
+}
+
+// Fork splits execution into two threads, as done by the Y instruction of
+// Brainfork: in the current thread, the current data cell is set to 0. The
+// new thread continues after the current instruction with the data pointer
+// moved one cell to the right, where that cell is set to 1. Threads take
+// turns executing one instruction each.
+func (p *Processor) Fork() error {
+	if p.closures[0].Skip {
+		return nil
+	}
+	// Room for the new thread's cell, and the thread itself
+	p.DataPointer++
+	err := p.EnsureDataSize()
+	p.DataPointer--
+	if err != nil {
+		return err
+	}
+	if p.MaxData > 0 && p.DataCells() >= p.MaxData {
+		return ErrDataLimit
+	}
+
+	p.Data[p.DataPointer] = 0
+	p.CellWritten()
+
+	child := &thread{
+		dataPointer:        p.DataPointer + 1,
+		instructionPointer: p.instructionPointer + 1,
+		closures:           append([]*Closure{}, p.closures...),
+	}
+	p.threads = append(p.threads, child)
+
+	// Set up the child's cell as that thread would
+	p.DataPointer++
+	p.Data[p.DataPointer] = 1
+	p.CellWritten()
+	p.DataPointer--
+	return nil
+}
+
+// Threads returns the number of threads of execution.
+func (p *Processor) Threads() int {
+	return 1 + len(p.threads)
+}
+
+// switchThread continues with the next thread, suspending the current one
+// or dropping it if it has ended.
+func (p *Processor) switchThread(ended bool) {
+	if !ended {
+		p.threads = append(p.threads, &thread{
+			dataPointer:        p.DataPointer,
+			instructionPointer: p.instructionPointer,
+			closures:           p.closures,
+		})
+	}
+
+	next := p.threads[0]
+	p.threads = p.threads[1:]
+	p.DataPointer = next.dataPointer
+	p.instructionPointer = next.instructionPointer
+	p.closures = next.closures
+}
@@ -0,0 +1,18 @@
+package bf
+
+// Trap makes handler get called with any error of an instruction, except
+// for ErrHalted and ErrInterrupted. Execution continues after the failed
+// instruction unless handler returns an error in turn. Errors within
+// handler itself do not get trapped. A nil handler removes the trap.
+func (p *Processor) Trap(handler func(p *Processor, fault error) error) {
+	p.trap = handler
+}
+
+func (p *Processor) handleFault(fault error) error {
+	if p.trapping {
+		return fault
+	}
+	p.trapping = true
+	defer func() { p.trapping = false }()
+	return p.trap(p, fault)
+}
@@ -0,0 +1,71 @@
+// Package bfhttp mounts Brainfuck programs as HTTP endpoints.
+//
+//	http.Handle("/rot13", &bfhttp.Handler{Program: rot13})
+package bfhttp
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// Handler runs Program for each request, with the request body as its input
+// and its output as response body. The response is held back until the
+// program halted, so that it can fail with status 500 instead. Programs get
+// stopped once the request's context is done, as when the client went away.
+type Handler struct {
+	Program []byte
+
+	// ContentType of the responses, text/plain by default.
+	ContentType string
+
+	// Configure is called with the processor for each request before the
+	// program gets loaded, to change what it does at the end of input or
+	// whether the program can modify itself for example.
+	// Processors write output as bytes and set the current cell to 0 at the
+	// end of input unless changed.
+	Configure func(p *bf.Processor, r *http.Request)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var output bytes.Buffer
+	p := bf.NewProcessor()
+	p.ByteOutput = true
+	p.EOF = bf.EOFZero
+	p.Stdin(r.Body)
+	p.Stdout(&output)
+	if h.Configure != nil {
+		h.Configure(p, r)
+	}
+	p.Load(h.Program)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			p.Stop()
+		case <-done:
+		}
+	}()
+
+	err := p.Execute()
+	if err == nil {
+		err = p.ExpectEnd()
+	}
+	if err == nil {
+		err = p.Flush()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := h.ContentType
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(output.Bytes())
+}
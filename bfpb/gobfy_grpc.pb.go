@@ -0,0 +1,262 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: gobfy.proto
+
+package bfpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Executor_Run_FullMethodName       = "/gobfy.v1.Executor/Run"
+	Executor_RunStream_FullMethodName = "/gobfy.v1.Executor/RunStream"
+	Executor_Debug_FullMethodName     = "/gobfy.v1.Executor/Debug"
+)
+
+// ExecutorClient is the client API for Executor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ExecutorClient interface {
+	// Run executes a program until it halts and returns its output.
+	Run(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*RunResponse, error)
+	// RunStream executes a program interactively. The first request holds the
+	// program, the following ones its input. Output is sent as it is produced,
+	// followed by the result once the program halted.
+	RunStream(ctx context.Context, opts ...grpc.CallOption) (Executor_RunStreamClient, error)
+	// Debug executes a program step by step. The first request starts the
+	// program, paused before its first instruction, the following ones are
+	// commands. Each request is answered by the state once paused again.
+	Debug(ctx context.Context, opts ...grpc.CallOption) (Executor_DebugClient, error)
+}
+
+type executorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExecutorClient(cc grpc.ClientConnInterface) ExecutorClient {
+	return &executorClient{cc}
+}
+
+func (c *executorClient) Run(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*RunResponse, error) {
+	out := new(RunResponse)
+	err := c.cc.Invoke(ctx, Executor_Run_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executorClient) RunStream(ctx context.Context, opts ...grpc.CallOption) (Executor_RunStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Executor_ServiceDesc.Streams[0], Executor_RunStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &executorRunStreamClient{stream}
+	return x, nil
+}
+
+type Executor_RunStreamClient interface {
+	Send(*StreamRequest) error
+	Recv() (*StreamResponse, error)
+	grpc.ClientStream
+}
+
+type executorRunStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *executorRunStreamClient) Send(m *StreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *executorRunStreamClient) Recv() (*StreamResponse, error) {
+	m := new(StreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *executorClient) Debug(ctx context.Context, opts ...grpc.CallOption) (Executor_DebugClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Executor_ServiceDesc.Streams[1], Executor_Debug_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &executorDebugClient{stream}
+	return x, nil
+}
+
+type Executor_DebugClient interface {
+	Send(*DebugRequest) error
+	Recv() (*DebugState, error)
+	grpc.ClientStream
+}
+
+type executorDebugClient struct {
+	grpc.ClientStream
+}
+
+func (x *executorDebugClient) Send(m *DebugRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *executorDebugClient) Recv() (*DebugState, error) {
+	m := new(DebugState)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ExecutorServer is the server API for Executor service.
+// All implementations must embed UnimplementedExecutorServer
+// for forward compatibility
+type ExecutorServer interface {
+	// Run executes a program until it halts and returns its output.
+	Run(context.Context, *RunRequest) (*RunResponse, error)
+	// RunStream executes a program interactively. The first request holds the
+	// program, the following ones its input. Output is sent as it is produced,
+	// followed by the result once the program halted.
+	RunStream(Executor_RunStreamServer) error
+	// Debug executes a program step by step. The first request starts the
+	// program, paused before its first instruction, the following ones are
+	// commands. Each request is answered by the state once paused again.
+	Debug(Executor_DebugServer) error
+	mustEmbedUnimplementedExecutorServer()
+}
+
+// UnimplementedExecutorServer must be embedded to have forward compatible implementations.
+type UnimplementedExecutorServer struct {
+}
+
+func (UnimplementedExecutorServer) Run(context.Context, *RunRequest) (*RunResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Run not implemented")
+}
+func (UnimplementedExecutorServer) RunStream(Executor_RunStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method RunStream not implemented")
+}
+func (UnimplementedExecutorServer) Debug(Executor_DebugServer) error {
+	return status.Errorf(codes.Unimplemented, "method Debug not implemented")
+}
+func (UnimplementedExecutorServer) mustEmbedUnimplementedExecutorServer() {}
+
+// UnsafeExecutorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ExecutorServer will
+// result in compilation errors.
+type UnsafeExecutorServer interface {
+	mustEmbedUnimplementedExecutorServer()
+}
+
+func RegisterExecutorServer(s grpc.ServiceRegistrar, srv ExecutorServer) {
+	s.RegisterService(&Executor_ServiceDesc, srv)
+}
+
+func _Executor_Run_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutorServer).Run(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Executor_Run_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutorServer).Run(ctx, req.(*RunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Executor_RunStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ExecutorServer).RunStream(&executorRunStreamServer{stream})
+}
+
+type Executor_RunStreamServer interface {
+	Send(*StreamResponse) error
+	Recv() (*StreamRequest, error)
+	grpc.ServerStream
+}
+
+type executorRunStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *executorRunStreamServer) Send(m *StreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *executorRunStreamServer) Recv() (*StreamRequest, error) {
+	m := new(StreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Executor_Debug_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ExecutorServer).Debug(&executorDebugServer{stream})
+}
+
+type Executor_DebugServer interface {
+	Send(*DebugState) error
+	Recv() (*DebugRequest, error)
+	grpc.ServerStream
+}
+
+type executorDebugServer struct {
+	grpc.ServerStream
+}
+
+func (x *executorDebugServer) Send(m *DebugState) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *executorDebugServer) Recv() (*DebugRequest, error) {
+	m := new(DebugRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Executor_ServiceDesc is the grpc.ServiceDesc for Executor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Executor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gobfy.v1.Executor",
+	HandlerType: (*ExecutorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Run",
+			Handler:    _Executor_Run_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RunStream",
+			Handler:       _Executor_RunStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Debug",
+			Handler:       _Executor_Debug_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "gobfy.proto",
+}
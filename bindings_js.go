@@ -0,0 +1,134 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"syscall/js"
+)
+
+// jsBytes returns the bytes of a JavaScript string or Uint8Array.
+func jsBytes(v js.Value) []byte {
+	switch v.Type() {
+	case js.TypeUndefined, js.TypeNull:
+		return nil
+	case js.TypeString:
+		return []byte(v.String())
+	}
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b
+}
+
+func jsUint8Array(b []byte) js.Value {
+	array := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(array, b)
+	return array
+}
+
+// jsOutput passes each write to a JavaScript function as Uint8Array.
+type jsOutput struct {
+	f js.Value
+}
+
+func (o jsOutput) Write(b []byte) (int, error) {
+	o.f.Invoke(jsUint8Array(b))
+	return len(b), nil
+}
+
+func jsResult(result serveResult) js.Value {
+	object := js.Global().Get("Object").New()
+	object.Set("steps", result.Steps)
+	object.Set("timeNs", result.Time.Nanoseconds())
+	if result.Error != "" {
+		object.Set("error", result.Error)
+	}
+	if e := result.LimitExceeded; e != nil {
+		object.Set("limitExceeded", map[string]interface{}{"limit": e.Limit, "max": e.Max})
+	}
+	return object
+}
+
+// jsRun runs a program to its end, see exportBindings.
+func jsRun(this js.Value, args []js.Value) interface{} {
+	args = append(args, js.Undefined(), js.Undefined(), js.Undefined())
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if args[2].Type() == js.TypeFunction {
+		w = jsOutput{args[2]}
+	}
+	result := jsResult(runSubmitted(context.Background(), string(jsBytes(args[0])), bytes.NewReader(jsBytes(args[1])), w, sandboxLimits{}))
+	result.Set("output", jsUint8Array(output.Bytes()))
+	return result
+}
+
+func jsState(state sessionState) js.Value {
+	if state.Result != nil {
+		object := jsResult(*state.Result)
+		object.Set("output", jsUint8Array(state.Output))
+		object.Set("halted", true)
+		return object
+	}
+	object := js.Global().Get("Object").New()
+	object.Set("instructionPointer", state.InstructionPointer)
+	object.Set("instruction", string(state.Instruction))
+	object.Set("dataPointer", state.DataPointer)
+	object.Set("cell", int(state.Cell))
+	object.Set("steps", state.Steps)
+	object.Set("output", jsUint8Array(state.Output))
+	object.Set("halted", false)
+	return object
+}
+
+// jsStart starts a program paused before its first instruction, see
+// exportBindings.
+func jsStart(this js.Value, args []js.Value) interface{} {
+	args = append(args, js.Undefined(), js.Undefined(), js.Undefined())
+	var w io.Writer
+	if args[2].Type() == js.TypeFunction {
+		w = jsOutput{args[2]}
+	}
+	s := startSession(string(jsBytes(args[0])), jsBytes(args[1]), w)
+
+	session := js.Global().Get("Object").New()
+	session.Set("step", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		n := uint64(1)
+		if len(args) > 0 && args[0].Type() == js.TypeNumber {
+			n = uint64(args[0].Int())
+		}
+		return jsState(s.Step(n))
+	}))
+	session.Set("run", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return jsState(s.Step(0))
+	}))
+	session.Set("stop", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return jsState(s.Stop())
+	}))
+	return session
+}
+
+// exportBindings makes programs runnable from JavaScript through a global
+// gobfy object, unless the command line given by the embedder asks for
+// something else. The command line still configures how programs run.
+//
+//	gobfy.run(program, input[, onOutput]) runs a program to its end and
+//	returns its result, holding the output as Uint8Array unless passed to
+//	onOutput as it is produced.
+//
+//	gobfy.start(program, input[, onOutput]) returns a session with the
+//	program paused before its first instruction, which step([n]) executes n
+//	instructions of, run() to its end and stop() stops. Each returns the
+//	state of the program, or its result once halted.
+func exportBindings(command string) bool {
+	if command != cmdRun.FullCommand() || len(*argRunInput) > 0 || *flagExecute != "" {
+		return false
+	}
+	gobfy := js.Global().Get("Object").New()
+	gobfy.Set("run", js.FuncOf(jsRun))
+	gobfy.Set("start", js.FuncOf(jsStart))
+	js.Global().Set("gobfy", gobfy)
+	return true
+}
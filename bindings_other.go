@@ -0,0 +1,9 @@
+//go:build !js || !wasm
+// +build !js !wasm
+
+package main
+
+// There is no JavaScript to export bindings to on this platform.
+func exportBindings(command string) bool {
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import "github.com/icedream/gobfy/bf"
+
+// The bitwise extension adds bit operations, which would otherwise take
+// long loops to emulate.
+var bitwise = &bf.Extension{
+	Name:        "bitwise",
+	Description: "Bitwise operations: & (and), | (or) and ^ (xor) combine the current cell with the one right of it, storing the result in the current cell, ~ inverts the bits of the current cell.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		combine := func(op func(a, b byte) byte) func(p *bf.Processor) error {
+			return func(p *bf.Processor) error {
+				var next byte
+				if p.DataPointer+1 < len(p.Data) {
+					next = p.Data[p.DataPointer+1]
+				}
+				p.Data[p.DataPointer] = op(p.Data[p.DataPointer], next)
+				p.CellWritten()
+				return nil
+			}
+		}
+
+		return map[byte]func(p *bf.Processor) error{
+			'&': combine(func(a, b byte) byte { return a & b }),
+			'|': combine(func(a, b byte) byte { return a | b }),
+			'^': combine(func(a, b byte) byte { return a ^ b }),
+			'~': func(p *bf.Processor) error {
+				p.Data[p.DataPointer] = ^p.Data[p.DataPointer]
+				p.CellWritten()
+				return nil
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(bitwise)
+}
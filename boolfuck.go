@@ -0,0 +1,24 @@
+package main
+
+// Boolfuck has Brainfuck's instructions, but with data cells holding single
+// bits and ; for output, so that - and . are comments.
+var boolfuck = &Dialect{
+	Name:        "boolfuck",
+	Description: "Boolfuck, with single bit data cells and bitwise input and output",
+	Tokens: map[string]string{
+		"+": "+",
+		",": ",",
+		";": ".",
+		"<": "<",
+		">": ">",
+		"[": "[",
+		"]": "]",
+	},
+	BitCells: true,
+}
+
+func init() {
+	if err := registerDialect(boolfuck); err != nil {
+		panic(err)
+	}
+}
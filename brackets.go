@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// sourcePosition converts a byte offset into source to a 1-based line and
+// column pair.
+func sourcePosition(source []byte, offset int) (line, column int) {
+	line = 1 + bytes.Count(source[:offset], []byte{'\n'})
+	column = 1 + offset - (bytes.LastIndexByte(source[:offset], '\n') + 1)
+	return
+}
+
+// matchBrackets returns, for each loop instruction in source, the offset of
+// its counterpart. All other entries are -1.
+func matchBrackets(source []byte) ([]int, error) {
+	matches := make([]int, len(source))
+	open := []int{}
+
+	for i, b := range source {
+		matches[i] = -1
+
+		switch b {
+		case bf.InstLoopStart:
+			open = append(open, i)
+		case bf.InstLoopEnd:
+			if len(open) == 0 {
+				line, column := sourcePosition(source, i)
+				return nil, fmt.Errorf("%d:%d: unexpected end of loop, not in any loop", line, column)
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			matches[start] = i
+			matches[i] = start
+		}
+	}
+
+	if len(open) > 0 {
+		line, column := sourcePosition(source, open[len(open)-1])
+		return nil, fmt.Errorf("%d:%d: loop is never closed", line, column)
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import "github.com/icedream/gobfy/bf"
+
+// Brainfork adds an instruction splitting execution into two threads.
+var brainfork = &bf.Extension{
+	Name:        "brainfork",
+	Description: "Brainfork: Y forks the program, setting the current cell to 0 and continuing in a new thread with the cell to the right set to 1.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		return map[byte]func(p *bf.Processor) error{
+			'Y': func(p *bf.Processor) error {
+				return p.Fork()
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(brainfork)
+}
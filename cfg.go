@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+type cfgNode struct {
+	start int
+	code  []byte
+}
+
+// writeCFG writes the control-flow graph of source in Graphviz DOT format.
+// Straight-line runs of instructions form one node each, every loop
+// instruction gets its own conditional node branching on the current cell.
+func writeCFG(w io.Writer, source []byte) error {
+	matches, err := matchBrackets(source)
+	if err != nil {
+		return err
+	}
+
+	nodes := []*cfgNode{}
+	nodeAt := map[int]int{}
+	var current *cfgNode
+	for i, b := range source {
+		if !bf.IsInstruction(b) {
+			continue
+		}
+		if b == bf.InstLoopStart || b == bf.InstLoopEnd {
+			nodeAt[i] = len(nodes)
+			nodes = append(nodes, &cfgNode{start: i, code: []byte{b}})
+			current = nil
+			continue
+		}
+		if current == nil {
+			current = &cfgNode{start: i}
+			nodes = append(nodes, current)
+		}
+		current.code = append(current.code, b)
+	}
+
+	nodeName := func(index int) string {
+		if index >= len(nodes) {
+			return "halt"
+		}
+		return fmt.Sprintf("n%d", index)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph program {")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=\"monospace\"];")
+	fmt.Fprintln(bw, "\tstart [shape=oval];")
+	fmt.Fprintln(bw, "\thalt [shape=oval];")
+
+	for index, node := range nodes {
+		shape := ""
+		if node.code[0] == bf.InstLoopStart || node.code[0] == bf.InstLoopEnd {
+			shape = ", shape=diamond"
+		}
+		line, column := sourcePosition(source, node.start)
+		fmt.Fprintf(bw, "\t%s [label=\"%d:%d: %s\"%s];\n", nodeName(index), line, column, node.code, shape)
+	}
+
+	fmt.Fprintf(bw, "\tstart -> %s;\n", nodeName(0))
+	for index, node := range nodes {
+		switch node.code[0] {
+		case bf.InstLoopStart:
+			// Enter the loop body, or continue behind the matching end
+			fmt.Fprintf(bw, "\t%s -> %s [label=\"nonzero\"];\n", nodeName(index), nodeName(index+1))
+			fmt.Fprintf(bw, "\t%s -> %s [label=\"zero\"];\n", nodeName(index), nodeName(nodeAt[matches[node.start]]+1))
+		case bf.InstLoopEnd:
+			// Jump back into the loop body, or leave the loop
+			fmt.Fprintf(bw, "\t%s -> %s [label=\"nonzero\"];\n", nodeName(index), nodeName(nodeAt[matches[node.start]]+1))
+			fmt.Fprintf(bw, "\t%s -> %s [label=\"zero\"];\n", nodeName(index), nodeName(index+1))
+		default:
+			fmt.Fprintf(bw, "\t%s -> %s;\n", nodeName(index), nodeName(index+1))
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
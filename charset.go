@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Characters of the upper halves of code pages, for bytes 0x80 to 0xff.
+// The lower halves are ASCII.
+var codePages = map[string][]rune{
+	"cp437": []rune("ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»" +
+		"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+		"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■\u00a0"),
+	"cp1252": append([]rune("€�‚ƒ„…†‡ˆ‰Š‹Œ�Ž��‘’“”•–—˜™š›œ�žŸ"), latin1Runes(0xa0, 0xff)...),
+	"latin1": latin1Runes(0x80, 0xff),
+}
+
+func latin1Runes(first, last rune) []rune {
+	runes := []rune{}
+	for r := first; r <= last; r++ {
+		runes = append(runes, r)
+	}
+	return runes
+}
+
+// charsetWriter converts bytes of a code page to UTF-8.
+type charsetWriter struct {
+	w     io.Writer
+	upper []rune
+}
+
+// newCharsetWriter returns a writer converting bytes of the code page named
+// name to UTF-8 for w.
+func newCharsetWriter(w io.Writer, name string) (*charsetWriter, error) {
+	upper, ok := codePages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output encoding %s", name)
+	}
+	return &charsetWriter{w, upper}, nil
+}
+
+func (c *charsetWriter) Write(b []byte) (int, error) {
+	out := make([]byte, 0, len(b))
+	for _, char := range b {
+		if char < utf8.RuneSelf {
+			out = append(out, char)
+		} else {
+			out = append(out, string(c.upper[char-0x80])...)
+		}
+	}
+	if _, err := c.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// checkProgram validates source without executing it: strict mode (if
+// enabled) and loop matching produce errors, lint findings produce warnings.
+// Finally a summary of what the loop analysis recognized is printed. Returns
+// whether there were neither errors nor warnings.
+func checkProgram(w io.Writer, path string, source []byte, strict bool) bool {
+	if strict {
+		if err := checkStrict(source); err != nil {
+			fmt.Fprintf(w, "%s:%s\n", path, err)
+			return false
+		}
+	}
+
+	findings, err := lintSource(source)
+	if err != nil {
+		fmt.Fprintf(w, "%s:%s\n", path, err)
+		return false
+	}
+	for _, finding := range findings {
+		line, column := sourcePosition(source, finding.Offset)
+		fmt.Fprintf(w, "%s:%d:%d: warning: %s\n", path, line, column, finding.Message)
+	}
+
+	loops, err := analyzeLoops(source)
+	if err != nil {
+		fmt.Fprintf(w, "%s:%s\n", path, err)
+		return false
+	}
+	kinds := map[string]int{}
+	for _, loop := range loops {
+		kinds[loop.Kind]++
+	}
+	fmt.Fprintf(w, "%s: %d loops, %d recognized (%d clear, %d scan, %d copy, %d multiply), %d unclassified\n",
+		path, len(loops), len(loops)-kinds[loopKindUnclassified],
+		kinds[loopKindClear], kinds[loopKindScan], kinds[loopKindCopy], kinds[loopKindMultiply],
+		kinds[loopKindUnclassified])
+
+	return len(findings) == 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// The clock extension adds an instruction reading the current time. With
+// --fixed-clock, time starts at the given moment and advances by one
+// millisecond per executed instruction, so that runs are reproducible. The
+// time is also available without extra instructions from the clock device.
+var clock = &bf.Extension{
+	Name:        "clock",
+	Description: "Clock: * writes the current Unix time to the current cell and the five to its right, as seconds in four cells followed by milliseconds in two, most significant byte first.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		now, err := newClock()
+		if err != nil {
+			return nil, err
+		}
+
+		return map[byte]func(p *bf.Processor) error{
+			'*': func(p *bf.Processor) error {
+				return p.WriteCells(encodeClockTime(now(p)))
+			},
+		}, nil
+	},
+}
+
+// newClock returns a function telling the time as configured by
+// --fixed-clock.
+func newClock() (func(p *bf.Processor) time.Time, error) {
+	if *flagFixedClock == "" {
+		return func(p *bf.Processor) time.Time {
+			return time.Now()
+		}, nil
+	}
+
+	start, err := parseClockTime(*flagFixedClock)
+	if err != nil {
+		return nil, err
+	}
+	return func(p *bf.Processor) time.Time {
+		return start.Add(time.Duration(p.Steps()) * time.Millisecond)
+	}, nil
+}
+
+// encodeClockTime returns t as Unix time in four cells of seconds followed
+// by two cells of milliseconds, most significant byte first.
+func encodeClockTime(t time.Time) []byte {
+	seconds := uint32(t.Unix())
+	millis := uint16(t.Nanosecond() / int(time.Millisecond))
+	return []byte{
+		byte(seconds >> 24), byte(seconds >> 16), byte(seconds >> 8), byte(seconds),
+		byte(millis >> 8), byte(millis),
+	}
+}
+
+// clockDevice provides the time in six data cells encoded like by the clock
+// extension. Reading the first cell updates all of them.
+type clockDevice struct {
+	now   func(p *bf.Processor) time.Time
+	cells []byte
+}
+
+func (d *clockDevice) ReadCell(p *bf.Processor, offset int) byte {
+	if offset == 0 || d.cells == nil {
+		d.cells = encodeClockTime(d.now(p))
+	}
+	return d.cells[offset]
+}
+
+func (d *clockDevice) WriteCell(p *bf.Processor, offset int, value byte) {}
+
+// parseClockTime parses either an RFC 3339 time or Unix time in seconds.
+func parseClockTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or Unix time in seconds", s)
+	}
+	return t, nil
+}
+
+func init() {
+	bf.RegisterExtension(clock)
+	registerDevice("clock", func() (bf.Device, int, error) {
+		now, err := newClock()
+		return &clockDevice{now: now}, 6, err
+	})
+}
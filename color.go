@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+
+	"github.com/icedream/gobfy/bf"
+	"golang.org/x/term"
+)
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+	ansiGray    = "\x1b[90m"
+	ansiInverse = "\x1b[7m"
+)
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// colorEnabled decides whether to use ANSI colors for output written to f.
+func colorEnabled(f *os.File, disabled bool) bool {
+	if disabled {
+		return false
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(f)
+}
+
+func colorize(enabled bool, style, s string) string {
+	if !enabled {
+		return s
+	}
+	return style + s + ansiReset
+}
+
+func instructionColor(instruction byte) string {
+	switch instruction {
+	case bf.InstMoveRight, bf.InstMoveLeft:
+		return ansiBlue
+	case bf.InstIncrement, bf.InstDecrement:
+		return ansiGreen
+	case bf.InstInput, bf.InstOutput:
+		return ansiMagenta
+	case bf.InstLoopStart, bf.InstLoopEnd:
+		return ansiYellow
+	}
+	return ansiGray
+}
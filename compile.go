@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const cPrologue = `#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#define PAGE_SIZE 1024
+
+static unsigned char *tape;
+static size_t size = PAGE_SIZE, ptr = 0;
+
+static void right(size_t n)
+{
+	ptr += n;
+	if (ptr >= size) {
+		size_t grown = (ptr / PAGE_SIZE + 1) * PAGE_SIZE;
+		if ((tape = realloc(tape, grown)) == NULL) {
+			perror("realloc");
+			exit(1);
+		}
+		memset(tape + size, 0, grown - size);
+		size = grown;
+	}
+}
+
+static void left(size_t n)
+{
+	if (n > ptr) {
+		fputs("can not move data pointer left, already at beginning of data\n", stderr);
+		exit(1);
+	}
+	ptr -= n;
+}
+
+static void output(void)
+{
+	/* Same as the interpreter, bytes are written as UTF-8 encoded runes */
+	unsigned char c = tape[ptr];
+	if (c < 0x80) {
+		putchar(c);
+	} else {
+		putchar(0xc0 | (c >> 6));
+		putchar(0x80 | (c & 0x3f));
+	}
+}
+
+static void input(void)
+{
+	int c;
+	fflush(stdout);
+	if ((c = getchar()) == EOF) {
+		fputs("EOF\n", stderr);
+		exit(1);
+	}
+	tape[ptr] = c;
+}
+
+int main(void)
+{
+	if ((tape = calloc(size, 1)) == NULL) {
+		perror("calloc");
+		return 1;
+	}
+
+`
+
+const cEpilogue = `
+	return 0;
+}
+`
+
+// writeC translates source to an equivalent C program. Runs of the same
+// arithmetic or movement instruction are folded into a single statement.
+func writeC(w io.Writer, source []byte) error {
+	if _, err := matchBrackets(source); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(cPrologue)
+
+	depth := 1
+	for i := 0; i < len(source); i++ {
+		instruction := source[i]
+		if !bf.IsInstruction(instruction) {
+			continue
+		}
+
+		count := 1
+		switch instruction {
+		case bf.InstIncrement, bf.InstDecrement, bf.InstMoveRight, bf.InstMoveLeft:
+			for i+1 < len(source) && source[i+1] == instruction {
+				count++
+				i++
+			}
+		}
+
+		if instruction == bf.InstLoopEnd {
+			depth--
+		}
+		indent := strings.Repeat("\t", depth)
+
+		switch instruction {
+		case bf.InstIncrement:
+			fmt.Fprintf(bw, "%stape[ptr] += %d;\n", indent, count)
+		case bf.InstDecrement:
+			fmt.Fprintf(bw, "%stape[ptr] -= %d;\n", indent, count)
+		case bf.InstMoveRight:
+			fmt.Fprintf(bw, "%sright(%d);\n", indent, count)
+		case bf.InstMoveLeft:
+			fmt.Fprintf(bw, "%sleft(%d);\n", indent, count)
+		case bf.InstOutput:
+			fmt.Fprintf(bw, "%soutput();\n", indent)
+		case bf.InstInput:
+			fmt.Fprintf(bw, "%sinput();\n", indent)
+		case bf.InstLoopStart:
+			fmt.Fprintf(bw, "%swhile (tape[ptr]) {\n", indent)
+			depth++
+		case bf.InstLoopEnd:
+			fmt.Fprintf(bw, "%s}\n", indent)
+		}
+	}
+
+	bw.WriteString(cEpilogue)
+	return bw.Flush()
+}
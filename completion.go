@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Completion scripts for each supported shell. They all ask gobfy itself
+// for candidates through kingpin's hidden --completion-bash flag, so
+// commands, flags and enum values never go out of sync with the binary.
+// Where no candidates are returned, the shell falls back to completing file
+// names. The word being completed is only passed on if it is a flag, as
+// kingpin would otherwise take a partial command name for an argument of the
+// default run command.
+var completionScripts = map[string]string{
+	"bash": `_%[1]s_completion() {
+    local cur words opts
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    words=( "${COMP_WORDS[@]:1:$COMP_CWORD-1}" )
+    [[ "${cur}" == -* ]] && words+=( "${cur}" )
+    opts=$( "${COMP_WORDS[0]}" --completion-bash "${words[@]}" )
+    COMPREPLY=( $(compgen -W "${opts}" -- "${cur}") )
+    return 0
+}
+complete -o default -F _%[1]s_completion %[1]s
+`,
+
+	"zsh": `#compdef %[1]s
+autoload -U bashcompinit && bashcompinit
+
+_%[1]s_completion() {
+    local cur words opts
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    words=( "${COMP_WORDS[@]:1:$COMP_CWORD-1}" )
+    [[ "${cur}" == -* ]] && words+=( "${cur}" )
+    opts=$( "${COMP_WORDS[0]}" --completion-bash "${words[@]}" )
+    COMPREPLY=( $(compgen -W "${opts}" -- "${cur}") )
+    return 0
+}
+complete -o default -F _%[1]s_completion %[1]s
+`,
+
+	"fish": `function __%[1]s_completion
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    if string match -q -- '-*' $current
+        set -a tokens $current
+    end
+    %[1]s --completion-bash $tokens[2..-1]
+end
+complete -c %[1]s -a '(__%[1]s_completion)'
+`,
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// writeCompletionScript writes the completion script for the given shell.
+func writeCompletionScript(w io.Writer, shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("no completion script for shell %s", shell)
+	}
+	_, err := fmt.Fprintf(w, script, app.Name)
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v3"
+)
+
+const projectConfigFile = ".gobfy.yaml"
+
+// configFiles returns the configuration files to load, in order of
+// increasing precedence.
+func configFiles() []string {
+	files := []string{}
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "gobfy", "config.yaml"))
+	}
+	return append(files, projectConfigFile)
+}
+
+type flagGetter interface {
+	GetFlag(name string) *kingpin.FlagClause
+}
+
+type cumulativeValue interface {
+	IsCumulative() bool
+}
+
+// configDefaults converts a configuration value to default values for the
+// flag described by model.
+func configDefaults(model *kingpin.FlagModel, value interface{}) ([]string, error) {
+	cumulative := false
+	if v, ok := model.Value.(cumulativeValue); ok {
+		cumulative = v.IsCumulative()
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		if !cumulative {
+			return nil, fmt.Errorf("%s: expected a single value", model.Name)
+		}
+		values := []string{}
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("%s: expected a value", model.Name)
+	case int:
+		// Counters such as verbose are cumulative booleans, repeat them
+		// the given number of times
+		if model.IsBoolFlag() && cumulative {
+			return make([]string, v), nil
+		}
+	}
+
+	return []string{fmt.Sprint(value)}, nil
+}
+
+func applyConfigFlags(clause flagGetter, models []*kingpin.FlagModel, config map[string]interface{}) error {
+	for _, model := range models {
+		value, ok := config[model.Name]
+		if !ok {
+			continue
+		}
+		defaults, err := configDefaults(model, value)
+		if err != nil {
+			return err
+		}
+		clause.GetFlag(model.Name).Default(defaults...)
+		delete(config, model.Name)
+	}
+	return nil
+}
+
+// applyConfigFile sets the defaults of flags from a YAML configuration file.
+// Top-level keys are global flag names, command flags go into a mapping
+// named after the command.
+func applyConfigFile(app *kingpin.Application, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) || noFileSystem(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	model := app.Model()
+	if err := applyConfigFlags(app, model.Flags, config); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	for _, command := range model.Commands {
+		commandConfig, ok := config[command.Name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := applyConfigFlags(app.GetCommand(command.Name), command.Flags, commandConfig); err != nil {
+			return fmt.Errorf("%s: %s: %s", path, command.Name, err)
+		}
+		for name := range commandConfig {
+			return fmt.Errorf("%s: %s: unknown option %s", path, command.Name, strconv.Quote(name))
+		}
+		delete(config, command.Name)
+	}
+
+	for name := range config {
+		return fmt.Errorf("%s: unknown option %s", path, strconv.Quote(name))
+	}
+	return nil
+}
+
+// scopeCommandEnvars binds the flags of commands to environment variables
+// prefixed with the command name, e.g. GOBFY_BENCH_RUNS for bench --runs, so
+// they can not clash with global flags of the same name.
+func scopeCommandEnvars(app *kingpin.Application) {
+	for _, command := range app.Model().Commands {
+		for _, flag := range command.Flags {
+			name := "GOBFY_" + command.Name + "_" + flag.Name
+			app.GetCommand(command.Name).GetFlag(flag.Name).Envar(strings.ToUpper(strings.Replace(name, "-", "_", -1)))
+		}
+	}
+}
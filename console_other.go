@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// Terminals already deliver input the way programs expect it.
+func consoleInput(f *os.File) io.Reader {
+	return f
+}
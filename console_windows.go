@@ -0,0 +1,66 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// consoleInput returns a reader for f that behaves like a terminal on other
+// platforms if f is a console: line breaks are read as "\n" instead of
+// "\r\n", and Ctrl+Z at the start of a line ends the input.
+func consoleInput(f *os.File) io.Reader {
+	var mode uint32
+	if windows.GetConsoleMode(windows.Handle(f.Fd()), &mode) != nil {
+		return f
+	}
+	return &consoleReader{f: f, lineStart: true}
+}
+
+type consoleReader struct {
+	f         *os.File
+	buf       []byte
+	lineStart bool
+	eof       bool
+}
+
+func (c *consoleReader) Read(b []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.eof {
+			// Reading again after Ctrl+Z waits for new input like on
+			// other platforms after Ctrl+D
+			c.eof = false
+			return 0, io.EOF
+		}
+		line := make([]byte, 4096)
+		n, err := c.f.Read(line)
+		c.buf = c.translate(line[:n])
+		if err != nil && len(c.buf) == 0 {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// translate converts line breaks and cuts off input at a Ctrl+Z that starts
+// a line.
+func (c *consoleReader) translate(input []byte) []byte {
+	input = bytes.Replace(input, []byte("\r\n"), []byte("\n"), -1)
+	for i, b := range input {
+		if b == 0x1a && c.lineStart {
+			c.eof = true
+			c.lineStart = true
+			return input[:i]
+		}
+		c.lineStart = b == '\n'
+	}
+	return input
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// writeCoverageReport writes the percentage of instructions in source that
+// have been executed at least once, followed by a listing of all source lines
+// containing instructions that never ran, with those instructions marked.
+func writeCoverageReport(w io.Writer, source []byte, hits []uint64) error {
+	total, covered := 0, 0
+	for i, b := range source {
+		if !isProgramInstruction(b) {
+			continue
+		}
+		total++
+		if hits[i] > 0 {
+			covered++
+		}
+	}
+
+	percentage := 100.0
+	if total > 0 {
+		percentage = 100 * float64(covered) / float64(total)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "coverage: %.1f%% of instructions executed (%d/%d)\n", percentage, covered, total)
+
+	offset := 0
+	for lineNumber, rawLine := range bytes.SplitAfter(source, []byte{'\n'}) {
+		line := bytes.TrimRight(rawLine, "\r\n")
+
+		marker := make([]byte, len(line))
+		dead := false
+		for i, b := range line {
+			switch {
+			case b == '\t':
+				marker[i] = '\t'
+			case isProgramInstruction(b) && hits[offset+i] == 0:
+				marker[i] = '^'
+				dead = true
+			default:
+				marker[i] = ' '
+			}
+		}
+
+		if dead {
+			fmt.Fprintf(bw, "%6d | %s\n", lineNumber+1, line)
+			fmt.Fprintf(bw, "%6s | %s\n", "", bytes.TrimRight(marker, " \t"))
+		}
+
+		offset += len(rawLine)
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,200 @@
+//go:build cshared
+// +build cshared
+
+package main
+
+// Embedding gobfy in other languages through a shared library with a C ABI,
+// built by
+//
+//	go build -tags cshared -buildmode=c-shared -o libgobfy.so github.com/icedream/gobfy
+//
+// along with libgobfy.h declaring the functions below. Strings returned are
+// allocated by malloc and need to be freed by gobfy_free.
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+typedef struct {
+	// Set once the program halted, leaving the other fields but steps, output
+	// and error unset
+	int halted;
+	size_t instruction_pointer;
+	char instruction;
+	size_t data_pointer;
+	unsigned char cell;
+	// Instructions executed so far
+	uint64_t steps;
+	// Output since the previous state
+	char *output;
+	size_t output_len;
+	// Why the program failed, NULL if it halted successfully
+	char *error;
+} gobfy_state;
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"unsafe"
+)
+
+var (
+	// Set once the command line got parsed, which needs to happen only once
+	configureMu  sync.Mutex
+	configured   bool
+	configureErr error
+
+	sessionsMu  sync.Mutex
+	sessions    = map[C.uintptr_t]*session{}
+	lastSession C.uintptr_t
+)
+
+// configure parses args as command line unless done before, and returns
+// whether it did.
+func configure(args []string) (bool, error) {
+	configureMu.Lock()
+	defer configureMu.Unlock()
+	if configured {
+		return false, configureErr
+	}
+	configured = true
+	_, configureErr = setup(args)
+	return true, configureErr
+}
+
+func getSession(handle C.uintptr_t) *session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return sessions[handle]
+}
+
+// cError returns err as string for C, or NULL for no error.
+func cError(err string) *C.char {
+	if err == "" {
+		return nil
+	}
+	return C.CString(err)
+}
+
+func cBytes(b []byte) (*C.char, C.size_t) {
+	return (*C.char)(C.CBytes(b)), C.size_t(len(b))
+}
+
+func setState(dst *C.gobfy_state, state sessionState) {
+	*dst = C.gobfy_state{
+		instruction_pointer: C.size_t(state.InstructionPointer),
+		instruction:         C.char(state.Instruction),
+		data_pointer:        C.size_t(state.DataPointer),
+		cell:                C.uchar(state.Cell),
+		steps:               C.uint64_t(state.Steps),
+	}
+	dst.output, dst.output_len = cBytes(state.Output)
+	if state.Result != nil {
+		dst.halted = 1
+		dst.error = cError(state.Result.Error)
+	}
+}
+
+// gobfy_init configures how programs run by the same command line flags as
+// the gobfy command, given as argc strings in argv. Needs to be called
+// before any other function, which otherwise configures the defaults.
+// Returns an error to be freed, or NULL on success.
+//
+//export gobfy_init
+func gobfy_init(argc C.int, argv **C.char) *C.char {
+	args := []string{}
+	for _, arg := range unsafe.Slice(argv, int(argc)) {
+		args = append(args, C.GoString(arg))
+	}
+	if ok, err := configure(args); !ok {
+		return C.CString("gobfy_init needs to be called before any other function")
+	} else if err != nil {
+		return C.CString(err.Error())
+	}
+	return nil
+}
+
+// gobfy_run runs program with input_len bytes of input to its end, and
+// stores its output and the instructions it executed. Returns why it failed
+// as error to be freed, or NULL if it halted successfully.
+//
+//export gobfy_run
+func gobfy_run(program *C.char, input *C.char, input_len C.size_t, output **C.char, output_len *C.size_t, steps *C.uint64_t) *C.char {
+	if _, err := configure(nil); err != nil {
+		return C.CString(err.Error())
+	}
+	var out bytes.Buffer
+	result := runSubmitted(context.Background(), C.GoString(program), bytes.NewReader(C.GoBytes(unsafe.Pointer(input), C.int(input_len))), &out, sandboxLimits{})
+	*output, *output_len = cBytes(out.Bytes())
+	*steps = C.uint64_t(result.Steps)
+	return cError(result.Error)
+}
+
+// gobfy_start starts program with input_len bytes of input, paused before
+// its first instruction, and returns a handle for gobfy_step, gobfy_stop and
+// gobfy_close, or 0 if gobfy could not be configured.
+//
+//export gobfy_start
+func gobfy_start(program *C.char, input *C.char, input_len C.size_t) C.uintptr_t {
+	if _, err := configure(nil); err != nil {
+		return 0
+	}
+	s := startSession(C.GoString(program), C.GoBytes(unsafe.Pointer(input), C.int(input_len)), nil)
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	lastSession++
+	sessions[lastSession] = s
+	return lastSession
+}
+
+// gobfy_step executes n instructions of a program started by gobfy_start,
+// or all remaining ones if n is 0, and stores its state then. Returns -1
+// for an unknown handle, otherwise whether the program halted.
+//
+//export gobfy_step
+func gobfy_step(handle C.uintptr_t, n C.uint64_t, state *C.gobfy_state) C.int {
+	s := getSession(handle)
+	if s == nil {
+		return -1
+	}
+	setState(state, s.Step(uint64(n)))
+	return state.halted
+}
+
+// gobfy_stop stops a program started by gobfy_start, and stores its state
+// once halted. Returns -1 for an unknown handle, 1 otherwise.
+//
+//export gobfy_stop
+func gobfy_stop(handle C.uintptr_t, state *C.gobfy_state) C.int {
+	s := getSession(handle)
+	if s == nil {
+		return -1
+	}
+	setState(state, s.Stop())
+	return 1
+}
+
+// gobfy_close stops a program started by gobfy_start unless halted, and
+// frees its resources.
+//
+//export gobfy_close
+func gobfy_close(handle C.uintptr_t) {
+	s := getSession(handle)
+	if s == nil {
+		return
+	}
+	s.Stop()
+	sessionsMu.Lock()
+	delete(sessions, handle)
+	sessionsMu.Unlock()
+}
+
+// gobfy_free frees memory returned by the functions above.
+//
+//export gobfy_free
+func gobfy_free(p unsafe.Pointer) {
+	C.free(p)
+}
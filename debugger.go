@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const debuggerHelp = `Commands:
+  s, step [N]          execute N instructions (default 1), then pause again
+  c, continue          run until the next breakpoint
+  b, break POS         set a breakpoint at POS (LINE:COLUMN or byte offset)
+  d, delete POS        delete the breakpoint at POS
+  p, print             show the current instruction and data cells
+  bt, backtrace        show the nested code running, such as by eval
+  set [CELL] VALUE     set a data cell (default: the current one) to VALUE
+  ptr CELL             move the data pointer to CELL
+  q, quit              abort the program
+  h, help              show this help
+Values may be given in decimal, hexadecimal (0x41) or as character ('A').
+`
+
+// openTerminal opens the controlling terminal so that the debugger does not
+// compete with the program for standard input. Falls back to standard input
+// if there is no terminal.
+func openTerminal() io.Reader {
+	if f, err := os.Open("/dev/tty"); err == nil {
+		return f
+	}
+	return os.Stdin
+}
+
+// debugger pauses execution before the first instruction, at breakpoints and
+// after single-stepping, then reads commands to inspect and modify the
+// processor state until execution is resumed.
+type debugger struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	source []byte
+
+	breakpoints map[int]bool
+	// remaining is the number of steps to execute before pausing again, or 0
+	// to run until the next breakpoint.
+	remaining uint64
+	detached  bool
+}
+
+func newDebugger(in io.Reader, out io.Writer, source []byte) *debugger {
+	return &debugger{
+		in:          bufio.NewScanner(in),
+		out:         out,
+		source:      source,
+		breakpoints: map[int]bool{},
+		remaining:   1,
+	}
+}
+
+// Step is meant to be registered as step hook of a processor.
+func (d *debugger) Step(p *bf.Processor) {
+	if d.detached {
+		return
+	}
+
+	// Breakpoints are positions in the program, not in nested code
+	pause := d.breakpoints[p.InstructionPointer()] && len(p.CallStack()) == 0
+	if d.remaining > 0 {
+		d.remaining--
+		pause = pause || d.remaining == 0
+	}
+	if !pause {
+		return
+	}
+
+	d.print(p)
+	d.prompt(p)
+}
+
+func (d *debugger) print(p *bf.Processor) {
+	if stack := p.CallStack(); len(stack) > 0 {
+		fmt.Fprintf(d.out, "%s offset %d (step %d): %c\n%s\n", stack[len(stack)-1].Name, p.InstructionPointer(), p.Steps(), p.Instruction(), formatTapeWindow(p, 8))
+		return
+	}
+	line, column := sourcePosition(d.source, p.InstructionPointer())
+	fmt.Fprintf(d.out, "%d:%d (step %d): %c\n%s\n", line, column, p.Steps(), p.Instruction(), formatTapeWindow(p, 8))
+}
+
+func (d *debugger) parsePosition(s string) (int, error) {
+	if parts := strings.SplitN(s, ":", 2); len(parts) == 2 {
+		line, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, err
+		}
+		column, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, err
+		}
+		for offset := range d.source {
+			if l, c := sourcePosition(d.source, offset); l == line && c == column {
+				return offset, nil
+			}
+		}
+		return 0, fmt.Errorf("no such position: %s", s)
+	}
+
+	offset, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 || offset >= len(d.source) {
+		return 0, fmt.Errorf("offset out of range: %d", offset)
+	}
+	return offset, nil
+}
+
+func parseCellValue(s string) (byte, error) {
+	if strings.HasPrefix(s, "'") {
+		r, err := strconv.Unquote(s)
+		if err != nil || len(r) != 1 {
+			return 0, fmt.Errorf("invalid character value: %s", s)
+		}
+		return r[0], nil
+	}
+
+	value, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: %s", s)
+	}
+	return byte(value), nil
+}
+
+func parseCellIndex(s string) (int, error) {
+	index, err := strconv.ParseUint(s, 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cell: %s", s)
+	}
+	return int(index), nil
+}
+
+// setDataPointer moves the data pointer, growing the data cells as needed.
+func setDataPointer(p *bf.Processor, index int) error {
+	pointer := p.DataPointer
+	p.DataPointer = index
+	if err := p.EnsureDataSize(); err != nil {
+		p.DataPointer = pointer
+		return err
+	}
+	return nil
+}
+
+var errResume = errors.New("resume")
+
+func (d *debugger) command(p *bf.Processor, fields []string) error {
+	args := fields[1:]
+
+	switch fields[0] {
+	case "s", "step":
+		d.remaining = 1
+		if len(args) > 0 {
+			n, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil || n == 0 {
+				return fmt.Errorf("invalid step count: %s", args[0])
+			}
+			d.remaining = n
+		}
+		return errResume
+	case "c", "continue":
+		d.remaining = 0
+		return errResume
+	case "b", "break", "d", "delete":
+		if len(args) != 1 {
+			return errors.New("expected a position")
+		}
+		offset, err := d.parsePosition(args[0])
+		if err != nil {
+			return err
+		}
+		d.breakpoints[offset] = fields[0] == "b" || fields[0] == "break"
+	case "p", "print":
+		d.print(p)
+	case "bt", "backtrace":
+		if stack := p.CallStack(); len(stack) > 0 {
+			fmt.Fprintln(d.out, bf.FormatCallStack(stack))
+		} else {
+			fmt.Fprintln(d.out, "running the program itself")
+		}
+	case "set":
+		index := p.DataPointer
+		switch len(args) {
+		case 1:
+		case 2:
+			var err error
+			if index, err = parseCellIndex(args[0]); err != nil {
+				return err
+			}
+			args = args[1:]
+		default:
+			return errors.New("expected an optional cell and a value")
+		}
+		value, err := parseCellValue(args[0])
+		if err != nil {
+			return err
+		}
+		pointer := p.DataPointer
+		if err := setDataPointer(p, index); err != nil {
+			return err
+		}
+		p.Data[index] = value
+		p.DataPointer = pointer
+		fmt.Fprintln(d.out, formatTapeWindow(p, 8))
+	case "ptr":
+		if len(args) != 1 {
+			return errors.New("expected a cell")
+		}
+		index, err := parseCellIndex(args[0])
+		if err != nil {
+			return err
+		}
+		if err := setDataPointer(p, index); err != nil {
+			return err
+		}
+		fmt.Fprintln(d.out, formatTapeWindow(p, 8))
+	case "q", "quit":
+		// Like an interrupt, so that output gets written out and the
+		// terminal restored on the way out
+		p.Stop()
+		d.detached = true
+		return errResume
+	case "h", "help":
+		fmt.Fprint(d.out, debuggerHelp)
+	default:
+		return fmt.Errorf("unknown command %q, try \"help\"", fields[0])
+	}
+
+	return nil
+}
+
+func (d *debugger) prompt(p *bf.Processor) {
+	for {
+		fmt.Fprint(d.out, "(gobfy) ")
+		if !d.in.Scan() {
+			// No more commands, let the program run to its end
+			fmt.Fprintln(d.out)
+			d.detached = true
+			return
+		}
+
+		fields := strings.Fields(d.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch err := d.command(p, fields); err {
+		case nil:
+		case errResume:
+			return
+		default:
+			fmt.Fprintln(d.out, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// debugLogger formats the debug log with aligned columns, logged by the log
+// package. With color enabled, instructions are colored by kind and the data
+// pointer and cell value are highlighted whenever they changed since the last
+// line.
+type debugLogger struct {
+	color bool
+
+	lastPointer int
+	lastValue   byte
+}
+
+func (l *debugLogger) LogInstruction(p *bf.Processor) {
+	instruction := p.Instruction()
+	value := p.Data[p.DataPointer]
+	color := l.color
+
+	pointerStyle, valueStyle := "", ""
+	if p.DataPointer != l.lastPointer {
+		pointerStyle = ansiBold + ansiCyan
+	}
+	if value != l.lastValue || p.DataPointer != l.lastPointer {
+		valueStyle = ansiBold + ansiRed
+	}
+	l.lastPointer = p.DataPointer
+	l.lastValue = value
+
+	log.Printf("exec 0x%08x = %s  data: %s = %s (%s)  reserved data size: %d B",
+		p.InstructionPointer(),
+		colorize(color, instructionColor(instruction), fmt.Sprintf("%-6q", instruction)),
+		colorize(color, pointerStyle, fmt.Sprintf("0x%08x", p.DataPointer)),
+		colorize(color, valueStyle, fmt.Sprintf("%-6q", value)),
+		colorize(color, valueStyle, fmt.Sprintf("0x%02x", value)),
+		len(p.Data))
+
+	if p.DebugLevel >= bf.DebugLevelTape {
+		log.Print(formatTapeWindow(p, 8))
+	}
+}
+
+// LogLoop logs entering, skipping or exiting the loop at the current
+// instruction.
+func (l *debugLogger) LogLoop(p *bf.Processor, event string) {
+	color := l.color
+	log.Printf("%s loop at 0x%08x, data: 0x%08x = 0x%02x",
+		colorize(color, instructionColor(bf.InstLoopStart), fmt.Sprintf("%-5s", event)),
+		p.InstructionPointer(),
+		p.DataPointer,
+		p.Data[p.DataPointer])
+
+	if p.DebugLevel >= bf.DebugLevelTape {
+		log.Print(formatTapeWindow(p, 8))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// Built-in devices that can be mapped with --device, each with a function
+// returning a new instance along with the number of cells it takes.
+var devices = map[string]func() (bf.Device, int, error){}
+
+func registerDevice(name string, new func() (bf.Device, int, error)) {
+	devices[name] = new
+}
+
+// deviceNames returns the names of all built-in devices, sorted.
+func deviceNames() []string {
+	names := []string{}
+	for name := range devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mapDevices maps the built-in devices given by --device as NAME@CELL.
+func mapDevices(p *bf.Processor, specs []string) error {
+	for _, spec := range specs {
+		i := strings.LastIndexByte(spec, '@')
+		if i < 0 {
+			return fmt.Errorf("invalid device %q, expected NAME@CELL", spec)
+		}
+		name := spec[:i]
+		start, err := strconv.Atoi(spec[i+1:])
+		if err != nil {
+			return fmt.Errorf("invalid device %q, expected NAME@CELL", spec)
+		}
+
+		new, ok := devices[name]
+		if !ok {
+			return fmt.Errorf("unknown device %s, available are: %v", name, deviceNames())
+		}
+		device, size, err := new()
+		if err != nil {
+			return fmt.Errorf("device %s: %s", name, err)
+		}
+		if err := p.MapDevice(start, size, device); err != nil {
+			return fmt.Errorf("device %s: %s", name, err)
+		}
+	}
+	return nil
+}
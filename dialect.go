@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dialect is a language whose tokens map to Brainfuck instructions, or to
+// instructions added by extensions.
+type Dialect struct {
+	Name        string
+	Description string
+	// Translation of each token, whitespace within tokens matches any
+	// whitespace in the source
+	Tokens map[string]string
+	// Whether data cells hold single bits, see Processor.BitCells
+	BitCells bool
+	// Characters making up tokens, anything else in the source gets dropped
+	// before matching tokens. Empty for any character.
+	Alphabet string
+	// Extensions enabled for the instructions the tokens translate to
+	Extensions []string
+}
+
+// Brainfuck itself, selected by default.
+const defaultDialect = "bf"
+
+var dialects = map[string]*Dialect{}
+
+func registerDialect(d *Dialect) error {
+	if _, ok := dialects[d.Name]; ok || d.Name == defaultDialect {
+		return fmt.Errorf("dialect %s is already defined", d.Name)
+	}
+	if len(d.Tokens) == 0 {
+		return fmt.Errorf("dialect %s defines no tokens", d.Name)
+	}
+	for token := range d.Tokens {
+		if len(bytes.TrimSpace([]byte(token))) == 0 {
+			return fmt.Errorf("dialect %s: tokens can not be empty", d.Name)
+		}
+	}
+	dialects[d.Name] = d
+	return nil
+}
+
+// dialectNames returns the names of all languages for --lang, sorted.
+func dialectNames() []string {
+	names := []string{defaultDialect}
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkDialect fails unless name is a language known to --lang.
+func checkDialect(name string) error {
+	if _, ok := dialects[name]; !ok && name != defaultDialect {
+		return fmt.Errorf("unknown language %s, available are: %v", name, dialectNames())
+	}
+	return nil
+}
+
+// selectedDialect returns the dialect given by --lang, nil for Brainfuck.
+func selectedDialect() *Dialect {
+	return dialects[*flagLang]
+}
+
+// dialectExtensions returns the extensions to enable: those needed by the
+// dialect given by --lang, followed by those given by --ext.
+func dialectExtensions() []string {
+	names := []string{}
+	if d := selectedDialect(); d != nil {
+		names = append(names, d.Extensions...)
+	}
+	for _, name := range *flagExt {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// translateSource returns source translated from the language given by
+// --lang to instructions.
+func translateSource(source []byte) []byte {
+	d := selectedDialect()
+	if d == nil {
+		return source
+	}
+	return d.Translate(source)
+}
+
+// Translate returns the instructions for the tokens in source, matching the
+// longest token first. Anything else is dropped as comment.
+func (d *Dialect) Translate(source []byte) []byte {
+	type match struct {
+		token        []byte
+		instructions string
+	}
+	matches := []match{}
+	for token, instructions := range d.Tokens {
+		matches = append(matches, match{normalizeSpace([]byte(token)), instructions})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return len(matches[i].token) > len(matches[j].token)
+	})
+
+	if d.Alphabet != "" {
+		source = bytes.Map(func(r rune) rune {
+			if strings.ContainsRune(d.Alphabet, r) {
+				return r
+			}
+			return -1
+		}, source)
+	}
+	source = normalizeSpace(source)
+	result := []byte{}
+next:
+	for len(source) > 0 {
+		for _, m := range matches {
+			if bytes.HasPrefix(source, m.token) {
+				result = append(result, m.instructions...)
+				source = source[len(m.token):]
+				continue next
+			}
+		}
+		source = source[1:]
+	}
+	return result
+}
+
+// normalizeSpace returns s with each run of whitespace replaced by a single
+// space.
+func normalizeSpace(s []byte) []byte {
+	return bytes.Join(bytes.Fields(s), []byte(" "))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// The dump extension lets programs print their state for debugging.
+var dump = &bf.Extension{
+	Name:        "dump",
+	Description: "Dump: # prints the data pointer and the data cells around it to standard error.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		status := diagnostics()
+		return map[byte]func(p *bf.Processor) error{
+			'#': func(p *bf.Processor) error {
+				_, err := fmt.Fprintf(status, "after %d steps, data pointer %d\n%s\n",
+					p.Steps(), p.DataPointer, formatTapeWindow(p, 8))
+				return err
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(dump)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// encodeOutput returns a writer converting the bytes the program outputs
+// as selected by --io or --output-encoding, and a function writing out
+// anything still held back at the end of the program.
+func encodeOutput(w io.Writer) (io.Writer, func() error, error) {
+	noFlush := func() error { return nil }
+	if *flagOutputEncoding != "" {
+		if *flagIO != "latin1" {
+			return nil, nil, fmt.Errorf("can not combine --output-encoding with --io=%s", *flagIO)
+		}
+		c, err := newCharsetWriter(w, *flagOutputEncoding)
+		return c, noFlush, err
+	}
+
+	switch *flagIO {
+	case "utf8":
+		u := &utf8Writer{w: w, invalid: *flagInvalidUTF8}
+		return u, u.Flush, nil
+	case "hex":
+		// Dumps each byte right away, the characters column once a line
+		// is complete
+		d := hex.Dumper(w)
+		return d, d.Close, nil
+	case "base64":
+		e := base64.NewEncoder(base64.StdEncoding, w)
+		return e, func() error {
+			if err := e.Close(); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "\n")
+			return err
+		}, nil
+	}
+	return w, noFlush, nil
+}
+
+// utf8Writer passes on complete UTF-8 sequences, holding back the bytes of
+// an incomplete one until the following bytes arrive. Invalid bytes are
+// replaced by U+FFFD, dropped or taken as ISO 8859-1 characters, depending
+// on whether invalid is "replace", "drop" or "latin1".
+type utf8Writer struct {
+	w       io.Writer
+	invalid string
+	pending []byte
+}
+
+func (u *utf8Writer) Write(b []byte) (int, error) {
+	u.pending = append(u.pending, b...)
+
+	out := []byte{}
+	for len(u.pending) > 0 && utf8.FullRune(u.pending) {
+		r, size := utf8.DecodeRune(u.pending)
+		if r == utf8.RuneError && size == 1 {
+			out = u.appendInvalid(out, u.pending[0])
+		} else {
+			out = append(out, u.pending[:size]...)
+		}
+		u.pending = u.pending[size:]
+	}
+
+	if _, err := u.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (u *utf8Writer) appendInvalid(out []byte, b byte) []byte {
+	switch u.invalid {
+	case "drop":
+		return out
+	case "latin1":
+		return append(out, string(rune(b))...)
+	}
+	return append(out, string(utf8.RuneError)...)
+}
+
+// Flush writes out the bytes of an incomplete sequence held back, as
+// invalid bytes.
+func (u *utf8Writer) Flush() error {
+	out := []byte{}
+	for _, b := range u.pending {
+		out = u.appendInvalid(out, b)
+	}
+	u.pending = nil
+	_, err := u.w.Write(out)
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestUTF8Writer(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string
+		invalid string
+		output  string
+	}{
+		{"ascii", []string{"hello"}, "replace", "hello"},
+		{"complete", []string{"héllo ☃"}, "replace", "héllo ☃"},
+		{"split two bytes", []string{"h\xc3", "\xa9llo"}, "replace", "héllo"},
+		{"split four bytes", []string{"\xf0", "\x9f\x98", "\x80!"}, "replace", "\U0001F600!"},
+		{"invalid replaced", []string{"a\xffb"}, "replace", "a�b"},
+		{"invalid dropped", []string{"a\xffb"}, "drop", "ab"},
+		{"invalid as latin1", []string{"a\xe9b"}, "latin1", "aéb"},
+		{"truncated replaced", []string{"a\xc3", "b"}, "replace", "a�b"},
+		{"incomplete at the end replaced", []string{"a\xe2\x98"}, "replace", "a��"},
+		{"incomplete at the end dropped", []string{"a\xe2\x98"}, "drop", "a"},
+		{"incomplete at the end as latin1", []string{"a\xc3"}, "latin1", "aÃ"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		u := &utf8Writer{w: &out, invalid: test.invalid}
+		for _, w := range test.writes {
+			if n, err := u.Write([]byte(w)); n != len(w) || err != nil {
+				t.Fatalf("%s: writing %q returned %d, %v", test.name, w, n, err)
+			}
+		}
+		if err := u.Flush(); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if out.String() != test.output {
+			t.Errorf("%s: got %q, expected %q", test.name, out.String(), test.output)
+		}
+	}
+}
+
+func TestEncodeOutput(t *testing.T) {
+	defer func(io, encoding, invalid string) {
+		*flagIO, *flagOutputEncoding, *flagInvalidUTF8 = io, encoding, invalid
+	}(*flagIO, *flagOutputEncoding, *flagInvalidUTF8)
+	*flagInvalidUTF8 = "replace"
+
+	output := []byte("Hello, W\xc3\xb6rld!\n\x00\xff")
+	tests := []struct {
+		io       string
+		encoding string
+		output   string
+		err      bool
+	}{
+		{io: "latin1", output: string(output)},
+		{io: "utf8", output: "Hello, Wörld!\n\x00�"},
+		{io: "hex", output: hex.Dump(output)},
+		{io: "base64", output: base64.StdEncoding.EncodeToString(output) + "\n"},
+		{io: "utf8", encoding: "cp437", err: true},
+	}
+	for _, test := range tests {
+		*flagIO, *flagOutputEncoding = test.io, test.encoding
+		var out bytes.Buffer
+		w, flush, err := encodeOutput(&out)
+		if test.err {
+			if err == nil {
+				t.Errorf("--io=%s --output-encoding=%s: expected an error", test.io, test.encoding)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("--io=%s: %s", test.io, err)
+		}
+		// Programs output a byte at a time
+		for i := range output {
+			if _, err := w.Write(output[i : i+1]); err != nil {
+				t.Fatalf("--io=%s: %s", test.io, err)
+			}
+		}
+		if err := flush(); err != nil {
+			t.Fatalf("--io=%s: %s", test.io, err)
+		}
+		if out.String() != test.output {
+			t.Errorf("--io=%s: got %q, expected %q", test.io, out.String(), test.output)
+		}
+	}
+}
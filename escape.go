@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// unescape processes the escape sequences of Go string literals in s, such
+// as \n, \t, \x41 or \u00e9. Escaped bytes are kept as they are, escaped
+// runes get encoded as UTF-8. Double quotes need no escaping.
+func unescape(s string) ([]byte, error) {
+	result := []byte{}
+	for len(s) > 0 {
+		if s[0] == '"' {
+			result = append(result, '"')
+			s = s[1:]
+			continue
+		}
+
+		value, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return nil, fmt.Errorf("invalid escape sequence at %q", s)
+		}
+		if multibyte {
+			result = append(result, string(value)...)
+		} else {
+			result = append(result, byte(value))
+		}
+		s = tail
+	}
+	return result, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// The eval extension runs code built up in the data cells, for
+// metaprogramming and self-interpreters. Evaluated code can evaluate code
+// in turn, nested up to --eval-depth levels.
+var eval = &bf.Extension{
+	Name:        "eval",
+	Description: "Eval: = runs the NUL-terminated code starting at the cell right of the current one, on the same data cells and starting at the current one.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		maxDepth := *flagEvalDepth
+		if maxDepth < 1 {
+			return nil, fmt.Errorf("eval depth must be at least 1")
+		}
+
+		depth := 0
+		return map[byte]func(p *bf.Processor) error{
+			'=': func(p *bf.Processor) error {
+				if depth >= maxDepth {
+					return fmt.Errorf("can not eval, already nested %d levels deep (see --eval-depth)", maxDepth)
+				}
+				depth++
+				defer func() { depth-- }()
+				return p.Evaluate("eval", []byte(readCString(p, p.DataPointer+1)))
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(eval)
+}
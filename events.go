@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// eventLogger writes events as JSON lines to w.
+type eventLogger struct {
+	encoder *json.Encoder
+}
+
+func newEventLogger(w io.Writer) *eventLogger {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &eventLogger{encoder}
+}
+
+func (l *eventLogger) Event(e bf.Event) {
+	var entry struct {
+		bf.Event
+		Error       string `json:"error,omitempty"`
+		Instruction string `json:"instruction,omitempty"`
+	}
+	entry.Event = e
+	if e.Err != nil {
+		entry.Error = e.Err.Error()
+	}
+	if e.Instruction != 0 {
+		entry.Instruction = string(rune(e.Instruction))
+	}
+	l.encoder.Encode(entry)
+}
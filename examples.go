@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/tabwriter"
+)
+
+// Example programs, each starting with a line describing it.
+//
+//go:embed examples/*.b
+var examples embed.FS
+
+// exampleNames returns the names of all example programs.
+func exampleNames() []string {
+	entries, err := examples.ReadDir("examples")
+	if err != nil {
+		panic(err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".b"))
+	}
+	return names
+}
+
+// exampleSource returns the source of the example program with the given
+// name.
+func exampleSource(name string) ([]byte, error) {
+	source, err := examples.ReadFile(path.Join("examples", name+".b"))
+	if err != nil {
+		return nil, fmt.Errorf("no example program named %s, see 'gobfy examples list'", name)
+	}
+	return source, nil
+}
+
+// writeExampleList prints the names and descriptions of all example
+// programs to w.
+func writeExampleList(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, name := range exampleNames() {
+		source, err := exampleSource(name)
+		if err != nil {
+			return err
+		}
+		description, _ := bufio.NewReader(bytes.NewReader(source)).ReadString('\n')
+		fmt.Fprintf(tw, "%s\t%s\n", name, strings.TrimSpace(description))
+	}
+	return tw.Flush()
+}
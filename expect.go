@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const defaultExpectTimeout = 10 * time.Second
+
+// expectStep is a line of an expect script: waiting for output matching
+// pattern, sending input, or changing the time to wait for output.
+type expectStep struct {
+	line    int
+	pattern *regexp.Regexp
+	send    []byte
+	timeout time.Duration
+}
+
+// parseExpectScript reads an expect script from r. Each line holds one of
+//
+//	expect PATTERN   wait for output matching the regular expression
+//	send TEXT        send TEXT as input
+//	timeout DURATION give up waiting for output after DURATION (default 10s)
+//
+// with arguments optionally given as quoted Go string literals, to include
+// escape sequences such as \n. Empty lines and lines starting with # are
+// ignored.
+func parseExpectScript(r io.Reader) ([]expectStep, error) {
+	steps := []expectStep{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, " ", 2)
+		arg := ""
+		if len(parts) == 2 {
+			arg = strings.TrimSpace(parts[1])
+		}
+		if strings.HasPrefix(arg, `"`) {
+			var err error
+			if arg, err = strconv.Unquote(arg); err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted string %s", line, parts[1])
+			}
+		}
+
+		step := expectStep{line: line}
+		switch parts[0] {
+		case "expect":
+			pattern, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			step.pattern = pattern
+		case "send":
+			step.send = []byte(arg)
+		case "timeout":
+			timeout, err := time.ParseDuration(arg)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("line %d: invalid timeout %q", line, arg)
+			}
+			step.timeout = timeout
+		default:
+			return nil, fmt.Errorf("line %d: unknown command %q, expected expect, send or timeout", line, parts[0])
+		}
+		steps = append(steps, step)
+	}
+	return steps, scanner.Err()
+}
+
+// expectDriver feeds a program input as given by an expect script, once its
+// output matches what the script expects. The program's output needs to be
+// written to the driver, its input read from Input.
+type expectDriver struct {
+	Input *io.PipeReader
+	input *io.PipeWriter
+
+	mu      sync.Mutex
+	output  []byte
+	changed chan struct{}
+	halted  bool
+
+	done chan struct{}
+	err  error
+}
+
+// startExpect runs the expect script in the file at path for the program
+// running on p, which gets stopped if the script fails.
+func startExpect(path string, p *bf.Processor) (*expectDriver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := parseExpectScript(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", path, err)
+	}
+
+	d := &expectDriver{changed: make(chan struct{}, 1), done: make(chan struct{})}
+	d.Input, d.input = io.Pipe()
+	go func() {
+		defer close(d.done)
+		if d.err = d.run(steps); d.err != nil {
+			d.err = fmt.Errorf("%s:%s", path, d.err)
+			p.Stop()
+		}
+		// The program reads the end of input once the script is done
+		d.input.Close()
+	}()
+	return d, nil
+}
+
+func (d *expectDriver) run(steps []expectStep) error {
+	timeout := defaultExpectTimeout
+	for _, step := range steps {
+		switch {
+		case step.pattern != nil:
+			if err := d.expect(step.pattern, timeout); err != nil {
+				return fmt.Errorf("%d: %s", step.line, err)
+			}
+		case step.send != nil:
+			if _, err := d.input.Write(step.send); err != nil {
+				return fmt.Errorf("%d: program stopped reading input", step.line)
+			}
+		default:
+			timeout = step.timeout
+		}
+	}
+	return nil
+}
+
+// expect waits for output matching pattern, then drops the output up to
+// the end of the match.
+func (d *expectDriver) expect(pattern *regexp.Regexp, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		d.mu.Lock()
+		match := pattern.FindIndex(d.output)
+		if match != nil {
+			d.output = d.output[match[1]:]
+		}
+		halted := d.halted
+		d.mu.Unlock()
+
+		switch {
+		case match != nil:
+			return nil
+		case halted:
+			return fmt.Errorf("program halted while expecting %q", pattern)
+		}
+		select {
+		case <-d.changed:
+		case <-deadline.C:
+			return fmt.Errorf("no output matching %q within %s", pattern, timeout)
+		}
+	}
+}
+
+func (d *expectDriver) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	d.output = append(d.output, b...)
+	d.mu.Unlock()
+	d.notify()
+	return len(b), nil
+}
+
+func (d *expectDriver) notify() {
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Finish tells the driver that the program halted, and returns why the
+// script failed, if it did.
+func (d *expectDriver) Finish() error {
+	d.mu.Lock()
+	d.halted = true
+	d.mu.Unlock()
+	d.notify()
+	d.Input.Close()
+	<-d.done
+	return d.err
+}
@@ -0,0 +1,31 @@
+package main
+
+import "github.com/icedream/gobfy/bf"
+
+// Extended Brainfuck Type I adds instructions to end the program and to
+// copy cells through a storage register.
+var extended1 = &bf.Extension{
+	Name:        "extended1",
+	Description: "Extended Brainfuck Type I: @ ends the program, $ stores the current cell, ! retrieves the stored value into the current cell.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		var storage byte
+		return map[byte]func(p *bf.Processor) error{
+			'@': func(p *bf.Processor) error {
+				return bf.ErrHalted
+			},
+			'$': func(p *bf.Processor) error {
+				storage = p.Current()
+				return nil
+			},
+			'!': func(p *bf.Processor) error {
+				p.Data[p.DataPointer] = storage
+				p.CellWritten()
+				return nil
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(extended1)
+}
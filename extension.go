@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// Instructions added by the extensions enabled with --ext, so that they are
+// not taken for comments.
+var extensionTokens = map[byte]bool{}
+
+// isProgramInstruction reports whether b is an instruction, including those
+// added by the extensions enabled with --ext.
+func isProgramInstruction(b byte) bool {
+	return bf.IsInstruction(b) || extensionTokens[b]
+}
+
+// enableExtensions looks up the extensions with the given names and records
+// their instructions in extensionTokens.
+func enableExtensions(names []string) ([]*bf.Extension, error) {
+	enabled := []*bf.Extension{}
+	for _, name := range names {
+		ext, ok := bf.LookupExtension(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown extension %s, available are: %v", name, bf.ExtensionNames())
+		}
+		ops, err := ext.New()
+		if err != nil {
+			return nil, fmt.Errorf("extension %s: %s", name, err)
+		}
+		for token := range ops {
+			if bf.IsInstruction(token) {
+				return nil, fmt.Errorf("extension %s: can not replace standard instruction %q", name, token)
+			}
+			if extensionTokens[token] {
+				return nil, fmt.Errorf("extension %s: instruction %q is already taken by another extension", name, token)
+			}
+			extensionTokens[token] = true
+		}
+		enabled = append(enabled, ext)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchSource downloads a program, giving up after timeout or if the program
+// is larger than maxSize bytes.
+func fetchSource(url string, timeout time.Duration, maxSize int64) ([]byte, error) {
+	client := &http.Client{Timeout: timeout}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("fetching %s: program exceeds maximum size of %d bytes", url, maxSize)
+	}
+
+	source, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %s", url, err)
+	}
+	if int64(len(source)) > maxSize {
+		return nil, fmt.Errorf("fetching %s: program exceeds maximum size of %d bytes", url, maxSize)
+	}
+
+	return source, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// The ffi extension lets programs call the Go functions registered with
+// the processor, the built-in hostFunctions unless embedders add their own.
+var ffi = &bf.Extension{
+	Name:        "ffi",
+	Description: "Host functions: : calls the function selected by the current cell, with arguments and results in the cells right of it. Built in are 0 multiply (a b -> high low) and 1 divmod (a b -> quotient remainder).",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		return map[byte]func(p *bf.Processor) error{
+			':': func(p *bf.Processor) error {
+				return p.CallFunction()
+			},
+		}, nil
+	},
+}
+
+// hostFunctions are registered with every processor, each with its index
+// in the list.
+var hostFunctions = []*bf.HostFunction{
+	{
+		Name:    "multiply",
+		Args:    2,
+		Results: 2,
+		Call: func(args []byte) ([]byte, error) {
+			product := int(args[0]) * int(args[1])
+			return []byte{byte(product >> 8), byte(product)}, nil
+		},
+	},
+	{
+		Name:    "divmod",
+		Args:    2,
+		Results: 2,
+		Call: func(args []byte) ([]byte, error) {
+			if args[1] == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return []byte{args[0] / args[1], args[0] % args[1]}, nil
+		},
+	},
+}
+
+func init() {
+	bf.RegisterExtension(ffi)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+)
+
+// isFIFO reports whether there is a named pipe at path.
+func isFIFO(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// lazyFile opens the file at path once it is first read from or written to.
+// Opening a named pipe blocks until its other end gets opened too, which
+// would deadlock if the process at the other end opens its pipes in a
+// different order than the program uses them.
+type lazyFile struct {
+	path string
+	flag int
+	f    *os.File
+}
+
+func (l *lazyFile) open() error {
+	if l.f != nil {
+		return nil
+	}
+	f, err := os.OpenFile(l.path, l.flag, 0666)
+	if err != nil {
+		return err
+	}
+	l.f = f
+	return nil
+}
+
+func (l *lazyFile) Read(b []byte) (int, error) {
+	if err := l.open(); err != nil {
+		return 0, err
+	}
+	return l.f.Read(b)
+}
+
+func (l *lazyFile) Write(b []byte) (int, error) {
+	if err := l.open(); err != nil {
+		return 0, err
+	}
+	return l.f.Write(b)
+}
+
+func (l *lazyFile) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// makeFIFOs creates named pipes at those of paths that do not exist yet.
+// The returned function removes them again.
+func makeFIFOs(paths []string) (remove func(), err error) {
+	created := []string{}
+	remove = func() {
+		for _, path := range created {
+			os.Remove(path)
+		}
+	}
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err == nil || !os.IsNotExist(err) {
+			continue
+		}
+		if err := mkfifo(path); err != nil {
+			remove()
+			return nil, err
+		}
+		created = append(created, path)
+	}
+	return remove, nil
+}
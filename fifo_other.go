@@ -0,0 +1,18 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package main
+
+import "errors"
+
+// Named pipes work differently on this platform, they can't be created as
+// files.
+func mkfifo(path string) error {
+	return errors.New("can not create named pipes on this platform")
+}
+
+func ignoreSIGPIPE() {}
+
+func isBrokenPipe(err error) bool {
+	return false
+}
@@ -0,0 +1,26 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package main
+
+import (
+	"errors"
+	"os/signal"
+	"syscall"
+)
+
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, 0666)
+}
+
+// ignoreSIGPIPE makes writes to pipes without reader fail instead of
+// killing the process, also for standard output.
+func ignoreSIGPIPE() {
+	signal.Ignore(syscall.SIGPIPE)
+}
+
+// isBrokenPipe reports whether err is due to writing to a pipe without
+// reader.
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
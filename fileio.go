@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// File modes of the fileio extension, as given in the control cell.
+const (
+	fileModeRead = 1 + iota
+	fileModeWrite
+	fileModeAppend
+)
+
+// The fileio extension lets programs redirect their input or output
+// instructions to host files. Only files within the paths given by
+// --allow-file can be opened.
+var fileio = &bf.Extension{
+	Name:        "fileio",
+	Description: "File I/O: ( opens the file whose NUL-terminated path starts at the cell right of the current one, with the current cell selecting reading (1), writing (2) or appending (3), and sets the current cell to 0 on success or 1 on failure. Input or output instructions then use the file until ) closes it.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		allowed := []string{}
+		for _, path := range *flagAllowFile {
+			path, err := resolvePath(path)
+			if err != nil {
+				return nil, err
+			}
+			allowed = append(allowed, path)
+		}
+
+		var files []*os.File
+		var stdin io.Reader
+		var stdout io.Writer
+
+		open := func(p *bf.Processor) error {
+			mode := p.Current()
+			path, err := resolvePath(readCString(p, p.DataPointer+1))
+			if err == nil && !isPathAllowed(path, allowed) {
+				err = fmt.Errorf("%s is not within the paths given by --allow-file", path)
+			}
+
+			var f *os.File
+			if err == nil {
+				switch mode {
+				case fileModeRead:
+					f, err = os.Open(path)
+				case fileModeWrite:
+					f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+				case fileModeAppend:
+					f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+				default:
+					err = fmt.Errorf("invalid file mode %d", mode)
+				}
+			}
+			if err != nil {
+				if p.DebugLevel >= bf.DebugLevelLoops {
+					log.Printf("can not open file: %s", err)
+				}
+				p.Data[p.DataPointer] = 1
+				p.CellWritten()
+				return nil
+			}
+
+			files = append(files, f)
+			if mode == fileModeRead {
+				if stdin == nil {
+					stdin, _ = p.Streams()
+				}
+				p.Stdin(f)
+			} else {
+				if stdout == nil {
+					_, stdout = p.Streams()
+				}
+				p.Stdout(f)
+			}
+			p.Data[p.DataPointer] = 0
+			p.CellWritten()
+			return nil
+		}
+
+		closeFiles := func(p *bf.Processor) error {
+			if stdin != nil {
+				p.Stdin(stdin)
+				stdin = nil
+			}
+			if stdout != nil {
+				p.Stdout(stdout)
+				stdout = nil
+			}
+			var err error
+			for _, f := range files {
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			files = nil
+			return err
+		}
+
+		return map[byte]func(p *bf.Processor) error{
+			'(': open,
+			')': closeFiles,
+		}, nil
+	},
+}
+
+// readCString returns the bytes in the data cells from offset up to the
+// next one holding 0.
+func readCString(p *bf.Processor, offset int) string {
+	var b strings.Builder
+	for i := offset; i < len(p.Data) && p.Data[i] != 0; i++ {
+		b.WriteByte(p.Data[i])
+	}
+	return b.String()
+}
+
+// resolvePath returns the absolute path with symbolic links resolved as
+// far as the path exists.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved, nil
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return path, nil
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// isPathAllowed reports whether path is one of allowed or within one of them.
+func isPathAllowed(path string, allowed []string) bool {
+	for _, prefix := range allowed {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	bf.RegisterExtension(fileio)
+}
@@ -0,0 +1,15 @@
+//go:build js
+// +build js
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// noFileSystem returns whether err is due to running where there are no
+// files, like in browsers.
+func noFileSystem(err error) bool {
+	return errors.Is(err, syscall.ENOSYS)
+}
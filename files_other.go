@@ -0,0 +1,8 @@
+//go:build !js && !wasip1
+// +build !js,!wasip1
+
+package main
+
+func noFileSystem(err error) bool {
+	return false
+}
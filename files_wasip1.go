@@ -0,0 +1,15 @@
+//go:build wasip1
+// +build wasip1
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// noFileSystem returns whether err is due to the WASI runtime not giving
+// access to any directory, in which case opening files fails with EBADF.
+func noFileSystem(err error) bool {
+	return errors.Is(err, syscall.EBADF)
+}
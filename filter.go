@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// filterReader passes the data read from r through filter, which gets the
+// data held back from its previous call prepended. filter returns the data
+// to pass on and the data to hold back, eof tells that there is no more
+// data to come.
+type filterReader struct {
+	r      io.Reader
+	filter func(data []byte, eof bool) (out, held []byte)
+	buf    []byte
+	held   []byte
+	err    error
+}
+
+func (f *filterReader) Read(b []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		chunk := make([]byte, 4096)
+		n, err := f.r.Read(chunk)
+		f.err = err
+		f.buf, f.held = f.filter(append(f.held, chunk[:n]...), err != nil)
+	}
+
+	n := copy(b, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// crlfFilter translates "\r\n" line breaks to "\n".
+func crlfFilter(data []byte, eof bool) ([]byte, []byte) {
+	var held []byte
+	if !eof && bytes.HasSuffix(data, []byte("\r")) {
+		data, held = data[:len(data)-1], []byte("\r")
+	}
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), held
+}
+
+// trimNewlineFilter drops a line break at the end of the input, holding
+// back any line break until more data follows it.
+func trimNewlineFilter(data []byte, eof bool) ([]byte, []byte) {
+	for _, suffix := range []string{"\r\n", "\n", "\r"} {
+		if !bytes.HasSuffix(data, []byte(suffix)) {
+			continue
+		}
+		if !eof {
+			return data[:len(data)-len(suffix)], []byte(suffix)
+		}
+		if suffix != "\r" {
+			return data[:len(data)-len(suffix)], nil
+		}
+	}
+	return data, nil
+}
+
+// filterInput applies the filters given by --input-filter to r, in order.
+func filterInput(r io.Reader) io.Reader {
+	for _, name := range *flagInputFilter {
+		switch name {
+		case "crlf":
+			r = &filterReader{r: r, filter: crlfFilter}
+		case "trim-newline":
+			r = &filterReader{r: r, filter: trimNewlineFilter}
+		}
+	}
+	return r
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFilterInput(t *testing.T) {
+	defer func(filters []string) { *flagInputFilter = filters }(*flagInputFilter)
+
+	tests := []struct {
+		filters []string
+		input   string
+		output  string
+	}{
+		{nil, "a\r\nb\n", "a\r\nb\n"},
+		{[]string{"crlf"}, "a\r\nb\r\n", "a\nb\n"},
+		{[]string{"crlf"}, "a\rb\r", "a\rb\r"},
+		{[]string{"crlf"}, "\r\n\r\n", "\n\n"},
+		{[]string{"crlf"}, "\r\r\n", "\r\n"},
+		{[]string{"trim-newline"}, "", ""},
+		{[]string{"trim-newline"}, "abc", "abc"},
+		{[]string{"trim-newline"}, "abc\n", "abc"},
+		{[]string{"trim-newline"}, "abc\r\n", "abc"},
+		{[]string{"trim-newline"}, "abc\r", "abc\r"},
+		{[]string{"trim-newline"}, "a\nb\n", "a\nb"},
+		{[]string{"trim-newline"}, "abc\n\n", "abc\n"},
+		{[]string{"trim-newline"}, "\n", ""},
+		{[]string{"crlf", "trim-newline"}, "a\r\nb\r\n", "a\nb"},
+	}
+	for _, test := range tests {
+		*flagInputFilter = test.filters
+		// Read whole and a byte at a time, which splits up line breaks
+		for _, r := range []io.Reader{
+			strings.NewReader(test.input),
+			iotest.OneByteReader(strings.NewReader(test.input)),
+		} {
+			output, err := ioutil.ReadAll(filterInput(r))
+			if err != nil {
+				t.Fatalf("%v %q: %s", test.filters, test.input, err)
+			}
+			if string(output) != test.output {
+				t.Errorf("%v %q: got %q, expected %q", test.filters, test.input, output, test.output)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Large enough for programs writing lots of output to get by with few
+// system calls.
+const flushBufferSize = 64 * 1024
+
+// flushWriter buffers writes to w, flushing according to policy:
+// "every-byte" passes on each write right away, "newline" flushes after
+// writes containing a line feed, "block" once the buffer is full and "exit"
+// holds back everything until Flush is called.
+type flushWriter struct {
+	w      io.Writer
+	policy string
+	buf    *bufio.Writer
+	held   bytes.Buffer
+}
+
+// newFlushWriter returns a writer for w flushing according to --flush.
+// When set to auto, the policy is newline for terminals and block
+// otherwise, and every-byte if something else writes to the terminal while
+// the program runs.
+func newFlushWriter(w io.Writer, toTerminal, interleaved bool) *flushWriter {
+	policy := *flagFlush
+	if policy == "auto" {
+		switch {
+		case interleaved:
+			policy = "every-byte"
+		case toTerminal:
+			policy = "newline"
+		default:
+			policy = "block"
+		}
+	}
+	return &flushWriter{w: w, policy: policy, buf: bufio.NewWriterSize(w, flushBufferSize)}
+}
+
+func (f *flushWriter) Write(b []byte) (int, error) {
+	switch f.policy {
+	case "every-byte":
+		return f.w.Write(b)
+	case "exit":
+		return f.held.Write(b)
+	}
+
+	n, err := f.buf.Write(b)
+	if err == nil && f.policy == "newline" && bytes.IndexByte(b, '\n') >= 0 {
+		err = f.buf.Flush()
+	}
+	return n, err
+}
+
+// Flush writes out anything buffered.
+func (f *flushWriter) Flush() error {
+	if f.held.Len() > 0 {
+		if _, err := f.held.WriteTo(f.w); err != nil {
+			return err
+		}
+	}
+	return f.buf.Flush()
+}
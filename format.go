@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// Loops without nested loops or comments up to this length are kept on a
+// single line.
+const formatInlineLoopLength = 16
+
+func isInlineLoop(source []byte, matches []int, start int) bool {
+	end := matches[start]
+	if end-start+1 > formatInlineLoopLength {
+		return false
+	}
+	for _, b := range source[start+1 : end] {
+		if !bf.IsInstruction(b) || b == bf.InstLoopStart {
+			return false
+		}
+	}
+	return true
+}
+
+// formatSource lays out source with every loop body on its own lines,
+// indented by one tab per nesting level. Short innermost loops stay inline.
+// Comments are kept in place with their whitespace collapsed, line breaks
+// within comments are preserved.
+func formatSource(source []byte) ([]byte, error) {
+	matches, err := matchBrackets(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	line := []byte{}
+	depth := 0
+	inComment := false
+	pendingSpace := false
+
+	flush := func() {
+		if len(line) > 0 {
+			out.Write(bytes.Repeat([]byte{'\t'}, depth))
+			out.Write(line)
+			out.WriteByte('\n')
+			line = line[:0]
+		}
+		inComment = false
+		pendingSpace = false
+	}
+	appendCode := func(code []byte) {
+		if inComment && len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, code...)
+		inComment = false
+		pendingSpace = false
+	}
+
+	for i := 0; i < len(source); i++ {
+		b := source[i]
+		switch {
+		case b == bf.InstLoopStart && isInlineLoop(source, matches, i):
+			appendCode(source[i : matches[i]+1])
+			i = matches[i]
+		case b == bf.InstLoopStart:
+			appendCode([]byte{b})
+			flush()
+			depth++
+		case b == bf.InstLoopEnd:
+			flush()
+			depth--
+			appendCode([]byte{b})
+			flush()
+		case bf.IsInstruction(b):
+			appendCode([]byte{b})
+		case b == '\n':
+			if inComment {
+				flush()
+			}
+		case b == ' ' || b == '\t' || b == '\r':
+			pendingSpace = inComment
+		default:
+			if len(line) > 0 && (!inComment || pendingSpace) {
+				line = append(line, ' ')
+			}
+			line = append(line, b)
+			inComment = true
+			pendingSpace = false
+		}
+	}
+	flush()
+
+	return out.Bytes(), nil
+}
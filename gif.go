@@ -0,0 +1,93 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const (
+	gifCells      = 32
+	gifCellPixels = 16
+	gifFrameDelay = 10 // in 100ths of a second
+
+	gifPaletteGrays   = 128
+	gifPalettePointer = gifPaletteGrays
+	gifPaletteBorder  = gifPaletteGrays + 1
+)
+
+var gifPalette = func() color.Palette {
+	palette := make(color.Palette, 0, gifPaletteGrays+2)
+	for i := 0; i < gifPaletteGrays; i++ {
+		v := uint8(i * 255 / (gifPaletteGrays - 1))
+		palette = append(palette, color.RGBA{R: v, G: v, B: v, A: 255})
+	}
+	return append(palette,
+		color.RGBA{R: 255, A: 255},
+		color.RGBA{R: 64, G: 64, B: 96, A: 255})
+}()
+
+// gifRecorder captures a window of data cells around the data pointer every
+// interval steps and assembles the frames into an animated GIF. Each cell is
+// drawn as a square whose brightness represents its value, the cell the data
+// pointer is at is underlined in red.
+type gifRecorder struct {
+	interval uint64
+	anim     gif.GIF
+}
+
+func newGIFRecorder(interval uint64) *gifRecorder {
+	return &gifRecorder{interval: interval}
+}
+
+// Step is meant to be registered as step hook of a processor.
+func (r *gifRecorder) Step(p *bf.Processor) {
+	if (p.Steps()-1)%r.interval == 0 {
+		r.Capture(p)
+	}
+}
+
+// Capture unconditionally records a frame of the current processor state.
+func (r *gifRecorder) Capture(p *bf.Processor) {
+	width := gifCells * gifCellPixels
+	height := gifCellPixels + gifCellPixels/4
+	frame := image.NewPaletted(image.Rect(0, 0, width, height), gifPalette)
+
+	// Flip to the page of cells containing the data pointer
+	first := (p.DataPointer / gifCells) * gifCells
+
+	for i := 0; i < gifCells; i++ {
+		cell := first + i
+		value := byte(0)
+		if cell < len(p.Data) {
+			value = p.Data[cell]
+		}
+
+		x0 := i * gifCellPixels
+		for y := 0; y < height; y++ {
+			for x := x0; x < x0+gifCellPixels; x++ {
+				index := uint8(value) / (256 / gifPaletteGrays)
+				switch {
+				case y >= gifCellPixels:
+					index = gifPaletteBorder
+					if cell == p.DataPointer {
+						index = gifPalettePointer
+					}
+				case x == x0:
+					index = gifPaletteBorder
+				}
+				frame.SetColorIndex(x, y, index)
+			}
+		}
+	}
+
+	r.anim.Image = append(r.anim.Image, frame)
+	r.anim.Delay = append(r.anim.Delay, gifFrameDelay)
+}
+
+func (r *gifRecorder) Encode(w io.Writer) error {
+	return gif.EncodeAll(w, &r.anim)
+}
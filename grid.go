@@ -0,0 +1,48 @@
+package main
+
+import "github.com/icedream/gobfy/bf"
+
+// The grid extension turns the tape into the current row of an unbounded
+// two-dimensional grid of data cells. Rows are allocated as they are first
+// visited, moving up or down keeps the column.
+var grid = &bf.Extension{
+	Name:        "grid",
+	Description: "Two-dimensional tape: ^ moves the data pointer up a row, v down a row.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		rows := map[int][]byte{}
+		current := 0
+		moveRow := func(p *bf.Processor, offset int) error {
+			row := rows[current+offset]
+			if row == nil {
+				var err error
+				if row, err = p.NewData(bf.DefaultPageSize); err != nil {
+					return err
+				}
+				rows[current+offset] = row
+			}
+			previous, _ := p.SwapData(row, p.DataPointer)
+			// The new row may need to grow to the current column
+			if err := p.EnsureDataSize(); err != nil {
+				rows[current+offset], _ = p.SwapData(previous, p.DataPointer)
+				return err
+			}
+			rows[current] = previous
+			current += offset
+			rows[current] = p.Data
+			return nil
+		}
+
+		return map[byte]func(p *bf.Processor) error{
+			'^': func(p *bf.Processor) error {
+				return moveRow(p, -1)
+			},
+			'v': func(p *bf.Processor) error {
+				return moveRow(p, 1)
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(grid)
+}
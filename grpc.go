@@ -0,0 +1,221 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative bfpb/gobfy.proto
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+	"github.com/icedream/gobfy/bfpb"
+	"google.golang.org/grpc"
+)
+
+// executorServer implements the gRPC Executor service on top of the same
+// execution as the HTTP endpoints.
+type executorServer struct {
+	bfpb.UnimplementedExecutorServer
+}
+
+func resultMessage(result serveResult) *bfpb.Result {
+	message := &bfpb.Result{Steps: result.Steps, TimeNs: int64(result.Time), Error: result.Error}
+	if e := result.LimitExceeded; e != nil {
+		message.LimitExceeded = &bfpb.LimitExceeded{Limit: e.Limit, Max: e.Max}
+	}
+	return message
+}
+
+// requestLimits returns the limits of the server given timeout, lowered to
+// those requested.
+func requestLimits(timeout time.Duration, requested *bfpb.Limits) sandboxLimits {
+	return serverLimits(timeout).lower(sandboxLimits{
+		Steps:   requested.GetSteps(),
+		Memory:  requested.GetMemory(),
+		Output:  requested.GetOutput(),
+		Timeout: time.Duration(requested.GetTimeoutNs()),
+	})
+}
+
+func (executorServer) Run(ctx context.Context, req *bfpb.RunRequest) (*bfpb.RunResponse, error) {
+	var output bytes.Buffer
+	result := runSubmitted(ctx, string(req.Program), bytes.NewReader(req.Input), &output, requestLimits(*flagServeTimeout, req.Limits))
+	return &bfpb.RunResponse{Output: output.Bytes(), Result: resultMessage(result)}, nil
+}
+
+// streamOutput sends each write as output message of a stream.
+type streamOutput struct {
+	stream bfpb.Executor_RunStreamServer
+}
+
+func (o streamOutput) Write(b []byte) (int, error) {
+	// Messages get sent asynchronously, b may be reused right away
+	output := append([]byte{}, b...)
+	err := o.stream.Send(&bfpb.StreamResponse{Message: &bfpb.StreamResponse_Output{Output: output}})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (executorServer) RunStream(stream bfpb.Executor_RunStreamServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	program, ok := req.Message.(*bfpb.StreamRequest_Program)
+	if !ok {
+		return fmt.Errorf("expected program as first message")
+	}
+
+	// The program gets stopped once the client goes away
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	input, inputWriter := io.Pipe()
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				inputWriter.CloseWithError(err)
+				cancel()
+				return
+			}
+			switch message := req.Message.(type) {
+			case *bfpb.StreamRequest_Input:
+				inputWriter.Write(message.Input)
+			case *bfpb.StreamRequest_EndInput:
+				inputWriter.Close()
+			}
+		}
+	}()
+
+	result := runSubmitted(ctx, string(program.Program), input, streamOutput{stream}, requestLimits(*flagServeSessionTimeout, req.Limits))
+	input.Close()
+	return stream.Send(&bfpb.StreamResponse{Message: &bfpb.StreamResponse_Result{Result: resultMessage(result)}})
+}
+
+// rpcDebugger pauses execution like the interactive debugger, taking its
+// commands from a Debug stream.
+type rpcDebugger struct {
+	stream bfpb.Executor_DebugServer
+	output bytes.Buffer
+
+	breakpoints map[int]bool
+	// Steps to execute before pausing again, or 0 to run until the next
+	// breakpoint
+	remaining uint64
+	detached  bool
+}
+
+// state returns the current state of p, along with the output since the
+// previous state.
+func (d *rpcDebugger) state(p *bf.Processor) *bfpb.DebugState {
+	start := p.DataPointer - 8
+	if start < 0 {
+		start = 0
+	}
+	end := p.DataPointer + 9
+	if end > len(p.Data) {
+		end = len(p.Data)
+	}
+	state := &bfpb.DebugState{
+		InstructionPointer: uint64(p.InstructionPointer()),
+		DataPointer:        uint64(p.DataPointer),
+		Cells:              append([]byte{}, p.Data[start:end]...),
+		CellsStart:         uint64(start),
+		Steps:              p.Steps(),
+		Output:             append([]byte{}, d.output.Bytes()...),
+	}
+	if p.InstructionPointer() < len(p.Instructions()) {
+		state.Instruction = string(p.Instruction())
+	}
+	d.output.Reset()
+	return state
+}
+
+// Step is meant to be registered as step hook of a processor.
+func (d *rpcDebugger) Step(p *bf.Processor) {
+	if d.detached {
+		return
+	}
+	pause := d.breakpoints[p.InstructionPointer()] && len(p.CallStack()) == 0
+	if d.remaining > 0 {
+		d.remaining--
+		pause = pause || d.remaining == 0
+	}
+	if !pause {
+		return
+	}
+
+	for {
+		if err := d.stream.Send(d.state(p)); err != nil {
+			d.detach(p)
+			return
+		}
+		req, err := d.stream.Recv()
+		if err != nil {
+			d.detach(p)
+			return
+		}
+		switch command := req.Command.(type) {
+		case *bfpb.DebugRequest_Step:
+			d.remaining = command.Step
+			if d.remaining == 0 {
+				d.remaining = 1
+			}
+			return
+		case *bfpb.DebugRequest_Continue:
+			d.remaining = 0
+			return
+		case *bfpb.DebugRequest_SetBreakpoint:
+			d.breakpoints[int(command.SetBreakpoint)] = true
+		case *bfpb.DebugRequest_DeleteBreakpoint:
+			delete(d.breakpoints, int(command.DeleteBreakpoint))
+		}
+	}
+}
+
+// detach stops the program once the client went away.
+func (d *rpcDebugger) detach(p *bf.Processor) {
+	d.detached = true
+	p.Stop()
+}
+
+func (executorServer) Debug(stream bfpb.Executor_DebugServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	start, ok := req.Command.(*bfpb.DebugRequest_Start)
+	if !ok {
+		return fmt.Errorf("expected start as first message")
+	}
+
+	d := &rpcDebugger{stream: stream, breakpoints: map[int]bool{}, remaining: 1}
+	var p *bf.Processor
+	result := runSubmitted(stream.Context(), string(start.Start.Program), bytes.NewReader(start.Start.Input), &d.output, requestLimits(*flagServeSessionTimeout, start.Start.Limits),
+		func(processor *bf.Processor) {
+			p = processor
+			p.OnStep(d.Step)
+		})
+	if d.detached {
+		return stream.Context().Err()
+	}
+
+	state := &bfpb.DebugState{Halted: true, Output: d.output.Bytes(), Result: resultMessage(result)}
+	if p != nil {
+		state = d.state(p)
+		state.Halted, state.Result = true, resultMessage(result)
+	}
+	return stream.Send(state)
+}
+
+// serveGRPC runs the gRPC Executor service on l.
+func serveGRPC(l net.Listener) error {
+	server := grpc.NewServer(traceUnary, traceStream)
+	bfpb.RegisterExecutorServer(server, executorServer{})
+	return server.Serve(l)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompressSource transparently decompresses gzip-compressed source, which
+// is recognized by its magic bytes. Other source is returned as is. Fails if
+// the decompressed source is larger than maxSize bytes, unless maxSize is 0.
+func decompressSource(source []byte, maxSize int64) ([]byte, error) {
+	if !bytes.HasPrefix(source, gzipMagic) {
+		return source, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if maxSize == 0 {
+		return ioutil.ReadAll(r)
+	}
+	source, err = ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(source)) > maxSize {
+		return nil, fmt.Errorf("decompressed program exceeds maximum size of %d bytes", maxSize)
+	}
+	return source, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+const (
+	heatmapCellsPerRow = 64
+	heatmapCellPixels  = 8
+)
+
+// Background colors of the xterm 256 color palette, from cold to hot.
+var heatmapTerminalColors = []int{236, 52, 88, 124, 160, 196, 202, 208, 214, 220, 226, 228, 230, 231}
+
+// heat maps a write count to a value between 0 and 1 on a logarithmic scale
+// so that a few extremely hot cells don't drown out everything else.
+func heat(writes, maxWrites uint64) float64 {
+	if maxWrites == 0 {
+		return 0
+	}
+	return math.Log1p(float64(writes)) / math.Log1p(float64(maxWrites))
+}
+
+func maxWrites(writes []uint64) (max uint64) {
+	for _, count := range writes {
+		if count > max {
+			max = count
+		}
+	}
+	return
+}
+
+// Characters standing in for the colors without them, from cold to hot.
+var heatmapShades = []byte(" .:-=+*#%@")
+
+// writeHeatmap renders write counts as rows of colored blocks using ANSI
+// escape sequences. Cells never written to are rendered in dark gray.
+// Without color, cells are rendered as characters getting denser the hotter
+// they are, with cells never written to left blank.
+func writeHeatmap(w io.Writer, writes []uint64, colored bool) error {
+	max := maxWrites(writes)
+
+	bw := bufio.NewWriter(w)
+	for rowStart := 0; rowStart < len(writes); rowStart += heatmapCellsPerRow {
+		fmt.Fprintf(bw, "%08x ", rowStart)
+		for i := rowStart; i < rowStart+heatmapCellsPerRow && i < len(writes); i++ {
+			if !colored {
+				shade := 0
+				if writes[i] > 0 {
+					shade = 1 + int(heat(writes[i], max)*float64(len(heatmapShades)-2))
+				}
+				bw.WriteByte(heatmapShades[shade])
+				continue
+			}
+			colorIndex := 0
+			if writes[i] > 0 {
+				colorIndex = 1 + int(heat(writes[i], max)*float64(len(heatmapTerminalColors)-2))
+			}
+			fmt.Fprintf(bw, "\x1b[48;5;%dm ", heatmapTerminalColors[colorIndex])
+		}
+		if colored {
+			fmt.Fprint(bw, ansiReset)
+		}
+		fmt.Fprint(bw, "\n")
+	}
+	fmt.Fprintf(bw, "%d cells written, at most %d writes per cell\n", len(writes), max)
+
+	return bw.Flush()
+}
+
+func heatColor(h float64) color.RGBA {
+	// Black to red to yellow to white
+	scale := func(v float64) uint8 {
+		return uint8(math.Max(0, math.Min(1, v)) * 255)
+	}
+	return color.RGBA{
+		R: scale(h * 3),
+		G: scale(h*3 - 1),
+		B: scale(h*3 - 2),
+		A: 255,
+	}
+}
+
+// writeHeatmapPNG renders write counts as PNG image with one square per cell.
+func writeHeatmapPNG(w io.Writer, writes []uint64) error {
+	max := maxWrites(writes)
+
+	rows := (len(writes) + heatmapCellsPerRow - 1) / heatmapCellsPerRow
+	if rows == 0 {
+		rows = 1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, heatmapCellsPerRow*heatmapCellPixels, rows*heatmapCellPixels))
+
+	unwritten := color.RGBA{R: 32, G: 32, B: 32, A: 255}
+	for i := 0; i < rows*heatmapCellsPerRow; i++ {
+		c := unwritten
+		if i < len(writes) && writes[i] > 0 {
+			c = heatColor(heat(writes[i], max))
+		}
+
+		x0 := (i % heatmapCellsPerRow) * heatmapCellPixels
+		y0 := (i / heatmapCellsPerRow) * heatmapCellPixels
+		for y := y0; y < y0+heatmapCellPixels; y++ {
+			for x := x0; x < x0+heatmapCellPixels; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
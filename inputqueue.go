@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var errInputQueueFull = errors.New("too much input queued up")
+
+// inputQueue passes input received from a client on to a program reading
+// from a pipe, queueing it up meanwhile so that receiving never blocks and
+// the client gets noticed going away or interrupting the program even while
+// the program does not read.
+type inputQueue struct {
+	w *io.PipeWriter
+	// Most bytes to queue up, 0 for no limit
+	limit int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queued []byte
+	closed bool
+	err    error
+}
+
+// newInputQueue returns a queue along with the pipe the program reads its
+// input from, which is fine to pass to runSubmitted.
+func newInputQueue(limit int) (*inputQueue, *io.PipeReader) {
+	r, w := io.Pipe()
+	q := &inputQueue{w: w, limit: limit}
+	q.cond = sync.NewCond(&q.mu)
+	go q.forward()
+	return q, r
+}
+
+// Write queues up b, failing once closed or if more than limit bytes would
+// be queued up.
+func (q *inputQueue) Write(b []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if q.limit > 0 && len(q.queued)+len(b) > q.limit {
+		return 0, errInputQueueFull
+	}
+	q.queued = append(q.queued, b...)
+	q.cond.Signal()
+	return len(b), nil
+}
+
+// CloseWithError makes the program read err, or the end of input if nil,
+// after what is queued up.
+func (q *inputQueue) CloseWithError(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed, q.err = true, err
+		q.cond.Signal()
+	}
+}
+
+func (q *inputQueue) Close() error {
+	q.CloseWithError(nil)
+	return nil
+}
+
+func (q *inputQueue) forward() {
+	for {
+		q.mu.Lock()
+		for len(q.queued) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		queued, closed, err := q.queued, q.closed, q.err
+		q.queued = nil
+		q.mu.Unlock()
+
+		if len(queued) > 0 {
+			// Fails once the program halted
+			if _, err := q.w.Write(queued); err != nil {
+				return
+			}
+			continue
+		}
+		if closed {
+			q.w.CloseWithError(err)
+			return
+		}
+	}
+}
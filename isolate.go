@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+// checkIsolation fails on flags that would make isolate fail, to be called
+// before the server starts listening.
+func checkIsolation() error {
+	if !*flagServeIsolate {
+		if *flagServeIsolateMemory > 0 || *flagServeIsolateCPU > 0 || *flagServeIsolateCgroup {
+			return fmt.Errorf("can not use --isolate-memory, --isolate-cpu or --isolate-cgroup without --isolate")
+		}
+		return nil
+	}
+	if *flagServeIsolateCPU > 0 && !*flagServeIsolateCgroup {
+		return fmt.Errorf("can not limit the CPUs by --isolate-cpu without --isolate-cgroup")
+	}
+	if restrictIsolated() && *flagOTel {
+		return fmt.Errorf("can not use --otel with --isolate and extensions enabled, which forbids connecting to export traces")
+	}
+	return nil
+}
+
+// restrictIsolated returns whether --isolate forbids network connections
+// and changes to the file system, which programs can not get to without
+// extensions.
+func restrictIsolated() bool {
+	return len(enabledExtensions) > 0
+}
+
+// isolate applies --isolate to the server process, if given. The limits are
+// of the process rather than of each program, as a backstop for what the
+// interpreter's own limits do not catch.
+func isolate() error {
+	if err := checkIsolation(); err != nil || !*flagServeIsolate {
+		return err
+	}
+	return isolateProcess(uint64(*flagServeIsolateMemory), *flagServeIsolateCPU, *flagServeIsolateCgroup, restrictIsolated())
+}
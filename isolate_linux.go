@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Not declared by golang.org/x/sys/unix, see linux/seccomp.h.
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTSync = 1
+	seccompRetErrno        = 0x00050000
+	seccompRetAllow        = 0x7fff0000
+
+	// Offsets into struct seccomp_data, of the lower half of arguments on
+	// little-endian architectures
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArgs = 16
+
+	// Set for the system calls of the x32 ABI, which shares the
+	// architecture with amd64
+	x32SyscallBit = 0x40000000
+
+	cgroupRoot = "/sys/fs/cgroup"
+	// Of cpu.max, in microseconds
+	cgroupCPUPeriod = 100000
+)
+
+// seccompArchs are the architectures supported by restrictSystemCalls,
+// with the system calls they have beyond those of all architectures: the
+// one opening files with the flags as second argument, -1 if there is none,
+// and the ones changing the file system at paths.
+var seccompArchs = map[string]struct {
+	audit uint32
+	open  int
+	paths []uint32
+}{
+	// open; creat, mkdir, rmdir, rename, link, unlink, symlink, chmod,
+	// chown, lchown, mknod and renameat
+	"amd64": {unix.AUDIT_ARCH_X86_64, 2, []uint32{85, 83, 84, 82, 86, 87, 88, 90, 92, 94, 133, 264}},
+	// renameat
+	"arm64": {unix.AUDIT_ARCH_AARCH64, -1, []uint32{38}},
+}
+
+func isolateProcess(memory uint64, cpus float64, cgroup, restrict bool) error {
+	if cgroup {
+		if err := joinCgroup(memory, cpus); err != nil {
+			return fmt.Errorf("can not create cgroup: %s", err)
+		}
+	} else if memory > 0 {
+		// Which is where Go allocates its memory from since Linux 4.7
+		if err := unix.Setrlimit(unix.RLIMIT_DATA, &unix.Rlimit{Cur: memory, Max: memory}); err != nil {
+			return fmt.Errorf("can not limit memory: %s", err)
+		}
+	}
+	if restrict {
+		if err := restrictSystemCalls(); err != nil {
+			return fmt.Errorf("can not restrict system calls: %s", err)
+		}
+	}
+	return nil
+}
+
+// writeCgroupFile writes value to the interface file name of the cgroup at
+// dir, which needs to exist.
+func writeCgroupFile(dir, name, value string) error {
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// joinCgroup moves the process into a new cgroup below its own, limited to
+// memory bytes and cpus CPUs unless 0. The cgroup is left to be removed
+// along with the one it is in, as by systemd when stopping the service.
+func joinCgroup(memory uint64, cpus float64) error {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(cgroupRoot, &fs); err != nil {
+		return err
+	}
+	if fs.Type != unix.CGROUP2_SUPER_MAGIC {
+		return fmt.Errorf("cgroup v2 is not mounted at %s", cgroupRoot)
+	}
+	self, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return err
+	}
+	parent := ""
+	for _, line := range strings.Split(string(self), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			parent = filepath.Join(cgroupRoot, line[len("0::"):])
+		}
+	}
+	if parent == "" {
+		return fmt.Errorf("process is in no cgroup v2")
+	}
+
+	dir := filepath.Join(parent, fmt.Sprintf("gobfy-%d", os.Getpid()))
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	// Controllers are passed on only by cgroups without processes of
+	// their own
+	if err := writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return err
+	}
+	controllers := []string{}
+	if memory > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if cpus > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if len(controllers) > 0 {
+		if err := writeCgroupFile(parent, "cgroup.subtree_control", strings.Join(controllers, " ")); err != nil {
+			return err
+		}
+	}
+	if memory > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatUint(memory, 10)); err != nil {
+			return err
+		}
+	}
+	if cpus > 0 {
+		if err := writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", int(cpus*cgroupCPUPeriod), cgroupCPUPeriod)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bpfStmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// restrictSystemCalls makes opening sockets other than Unix domain sockets
+// fail for all threads of the process, along with opening files for writing
+// and changing the file system at paths. Files and sockets opened before are
+// not affected.
+func restrictSystemCalls() error {
+	arch, ok := seccompArchs[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("not supported on %s", runtime.GOARCH)
+	}
+
+	const (
+		load  = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		ret   = unix.BPF_RET | unix.BPF_K
+		jeq   = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jge   = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		jset  = unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K
+		allow = seccompRetAllow
+	)
+	fail := func(errno unix.Errno) unix.SockFilter {
+		return bpfStmt(ret, seccompRetErrno|uint32(errno))
+	}
+	filter := []unix.SockFilter{
+		bpfStmt(load, seccompDataArch),
+		bpfJump(jeq, arch.audit, 1, 0),
+		fail(unix.ENOSYS),
+		bpfStmt(load, seccompDataNr),
+		bpfJump(jge, x32SyscallBit, 0, 1),
+		fail(unix.ENOSYS),
+	}
+
+	paths := append([]uint32{
+		unix.SYS_MKDIRAT, unix.SYS_MKNODAT, unix.SYS_UNLINKAT, unix.SYS_RENAMEAT2,
+		unix.SYS_LINKAT, unix.SYS_SYMLINKAT, unix.SYS_TRUNCATE, unix.SYS_FCHMODAT,
+		unix.SYS_FCHOWNAT, unix.SYS_SETXATTR, unix.SYS_LSETXATTR,
+		unix.SYS_REMOVEXATTR, unix.SYS_LREMOVEXATTR,
+	}, arch.paths...)
+	for _, nr := range paths {
+		filter = append(filter, bpfJump(jeq, nr, 0, 1), fail(unix.EROFS))
+	}
+	// Takes its flags in a struct, callers fall back to openat
+	filter = append(filter, bpfJump(jeq, unix.SYS_OPENAT2, 0, 1), fail(unix.ENOSYS))
+
+	opens := map[uint32]uint32{unix.SYS_OPENAT: 2}
+	if arch.open >= 0 {
+		opens[uint32(arch.open)] = 1
+	}
+	for nr, flags := range opens {
+		filter = append(filter,
+			bpfJump(jeq, nr, 0, 4),
+			bpfStmt(load, seccompDataArgs+8*flags),
+			bpfJump(jset, unix.O_WRONLY|unix.O_RDWR|unix.O_CREAT|unix.O_TRUNC, 0, 1),
+			fail(unix.EROFS),
+			bpfStmt(ret, allow),
+		)
+	}
+
+	filter = append(filter,
+		bpfJump(jeq, unix.SYS_SOCKET, 0, 4),
+		bpfStmt(load, seccompDataArgs),
+		bpfJump(jeq, unix.AF_UNIX, 0, 1),
+		bpfStmt(ret, allow),
+		fail(unix.EACCES),
+		bpfStmt(ret, allow),
+	)
+
+	program := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	// Needed for the calling thread, which the others get synchronized to
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+	thread, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTSync, uintptr(unsafe.Pointer(&program)))
+	if errno != 0 {
+		return errno
+	}
+	if thread != 0 {
+		return fmt.Errorf("thread %d can not be restricted", thread)
+	}
+	return nil
+}
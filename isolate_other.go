@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func isolateProcess(memory uint64, cpus float64, cgroup, restrict bool) error {
+	return errors.New("can not isolate the server on this platform")
+}
@@ -0,0 +1,56 @@
+//go:build !js && !wasip1
+// +build !js,!wasip1
+
+package main
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var jobsBucket = []byte("jobs")
+
+// jobDB stores jobs as JSON by their ID.
+type jobDB struct {
+	db *bolt.DB
+}
+
+func openJobDB(path string) (*jobDB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &jobDB{db}, nil
+}
+
+// ForEach calls f with each job stored, stopping at the first error.
+func (d *jobDB) ForEach(f func(id, value []byte) error) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(f)
+	})
+}
+
+func (d *jobDB) Put(id string, value []byte) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(id), value)
+	})
+}
+
+func (d *jobDB) Delete(id string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+}
+
+func (d *jobDB) Close() error {
+	return d.db.Close()
+}
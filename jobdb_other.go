@@ -0,0 +1,19 @@
+//go:build js || wasip1
+// +build js wasip1
+
+package main
+
+import "errors"
+
+// The database needs memory mapped files, which are not available on this
+// platform.
+type jobDB struct{}
+
+func openJobDB(path string) (*jobDB, error) {
+	return nil, errors.New("can not store jobs on this platform")
+}
+
+func (d *jobDB) ForEach(f func(id, value []byte) error) error { return nil }
+func (d *jobDB) Put(id string, value []byte) error            { return nil }
+func (d *jobDB) Delete(id string) error                       { return nil }
+func (d *jobDB) Close() error                                 { return nil }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// States of a job.
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// job is a program submitted to the server to be executed in the
+// background, for programs running longer than a request may take.
+type job struct {
+	ID        string     `json:"id"`
+	State     string     `json:"state"`
+	Submitted time.Time  `json:"submitted"`
+	Finished  *time.Time `json:"finished,omitempty"`
+
+	Request serveRequest `json:"-"`
+	Result  *serveResult `json:"-"`
+
+	cancel context.CancelFunc
+}
+
+// jobRecord is how a job is stored, along with its program and result.
+type jobRecord struct {
+	*job
+	Request serveRequest `json:"request"`
+	Result  *serveResult `json:"result,omitempty"`
+}
+
+// jobStore keeps track of jobs, until ttl after they finished. Queued jobs
+// are executed by a fixed number of workers, in the order submitted. With a
+// database, jobs are stored in it and survive restarts of the server, with
+// jobs that did not finish before getting queued again.
+type jobStore struct {
+	ttl time.Duration
+	db  *jobDB
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	queue  []*job
+	queued *sync.Cond
+}
+
+// newJobStore returns a job store executing jobs with the given number of
+// workers, stored in the database at path unless empty.
+func newJobStore(ttl time.Duration, workers int, path string) (*jobStore, error) {
+	s := &jobStore{ttl: ttl, jobs: map[string]*job{}}
+	s.queued = sync.NewCond(&s.mu)
+	if path != "" {
+		db, err := openJobDB(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		s.db = db
+		if err := s.load(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s, nil
+}
+
+// load picks up the jobs stored in the database, queueing those that did
+// not finish yet.
+func (s *jobStore) load() error {
+	records := []jobRecord{}
+	err := s.db.ForEach(func(id, value []byte) error {
+		record := jobRecord{job: &job{}}
+		if err := json.Unmarshal(value, &record); err != nil {
+			return fmt.Errorf("job %s: %s", id, err)
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		j := record.job
+		j.Request, j.Result = record.Request, record.Result
+		if j.Finished == nil {
+			j.State = JobQueued
+			s.queue = append(s.queue, j)
+			s.jobs[j.ID] = j
+			continue
+		}
+		if expiry := j.Finished.Add(s.ttl); time.Now().Before(expiry) {
+			s.jobs[j.ID] = j
+			s.expire(j, time.Until(expiry))
+		} else {
+			s.delete(j)
+		}
+	}
+	// Continue in the order submitted
+	for i := 1; i < len(s.queue); i++ {
+		for k := i; k > 0 && s.queue[k].Submitted.Before(s.queue[k-1].Submitted); k-- {
+			s.queue[k], s.queue[k-1] = s.queue[k-1], s.queue[k]
+		}
+	}
+	return nil
+}
+
+// save stores j in the database, if any. Needs to be called with s.mu held.
+func (s *jobStore) save(j *job) {
+	if s.db == nil {
+		return
+	}
+	value, err := json.Marshal(jobRecord{job: j, Request: j.Request, Result: j.Result})
+	if err == nil {
+		err = s.db.Put(j.ID, value)
+	}
+	if err != nil {
+		fmt.Fprintf(diagnostics(), "job %s: %s\n", j.ID, err)
+	}
+}
+
+// delete forgets about j. Needs to be called with s.mu held.
+func (s *jobStore) delete(j *job) {
+	delete(s.jobs, j.ID)
+	if s.db == nil {
+		return
+	}
+	if err := s.db.Delete(j.ID); err != nil {
+		fmt.Fprintf(diagnostics(), "job %s: %s\n", j.ID, err)
+	}
+}
+
+// expire deletes j after ttl.
+func (s *jobStore) expire(j *job, ttl time.Duration) {
+	time.AfterFunc(ttl, func() {
+		s.mu.Lock()
+		s.delete(j)
+		s.mu.Unlock()
+	})
+}
+
+// work executes queued jobs one after another.
+func (s *jobStore) work() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 {
+			s.queued.Wait()
+		}
+		j := s.queue[0]
+		s.queue = s.queue[1:]
+		if j.State != JobQueued {
+			// Canceled while queued
+			s.mu.Unlock()
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		j.State, j.cancel = JobRunning, cancel
+		s.save(j)
+		s.mu.Unlock()
+
+		result := executeSubmitted(ctx, j.Request, serverLimits(*flagServeJobTimeout).lower(j.Request.Limits))
+		cancel()
+		s.finish(j, result)
+	}
+}
+
+// finish records the result of j, keeping it canceled if it got canceled.
+func (s *jobStore) finish(j *job, result serveResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := time.Now()
+	j.Result, j.Finished = &result, &finished
+	switch {
+	case j.State == JobCanceled:
+	case result.Error != "":
+		j.State = JobFailed
+	default:
+		j.State = JobDone
+	}
+	s.save(j)
+	s.expire(j, s.ttl)
+}
+
+func newJobID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// Submit queues req for execution and returns a copy of its job.
+func (s *jobStore) Submit(req serveRequest) job {
+	j := &job{ID: newJobID(), State: JobQueued, Submitted: time.Now(), Request: req}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.ID] = j
+	s.queue = append(s.queue, j)
+	s.save(j)
+	s.queued.Signal()
+	return *j
+}
+
+// Get returns a copy of the job with the given ID, and whether there is one.
+func (s *jobStore) Get(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// Cancel stops the job with the given ID if it did not finish yet, and
+// returns whether there is such a job.
+func (s *jobStore) Cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	switch {
+	case !ok:
+	case j.State == JobQueued:
+		finished := time.Now()
+		j.State, j.Finished = JobCanceled, &finished
+		j.Result = &serveResult{Error: context.Canceled.Error()}
+		s.save(j)
+		s.expire(j, s.ttl)
+	case j.State == JobRunning:
+		j.State = JobCanceled
+		j.cancel()
+	}
+	return ok
+}
+
+// handleSubmit queues a job for a program submitted by POST to /jobs, like
+// to /run, and responds with the job right away.
+func (s *jobStore) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("jobs need to be submitted by POST"))
+		return
+	}
+	req, err := readSubmission(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	j := s.Submit(req)
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// handleJob serves the status of a job at /jobs/ID, its result at
+// /jobs/ID/result, and cancels it on DELETE of /jobs/ID.
+func (s *jobStore) handleJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	resource := ""
+	if i := strings.Index(id, "/"); i >= 0 {
+		id, resource = id[:i], id[i+1:]
+	}
+	if resource != "" && resource != "result" {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no such resource %q", resource))
+		return
+	}
+
+	allowed := []string{http.MethodGet}
+	if resource == "" {
+		allowed = append(allowed, http.MethodDelete)
+	}
+	if r.Method != http.MethodGet && (r.Method != http.MethodDelete || resource != "") {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	if r.Method == http.MethodDelete && !s.Cancel(id) {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no job %q", id))
+		return
+	}
+	j, ok := s.Get(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no job %q", id))
+		return
+	}
+
+	switch {
+	case resource == "":
+		writeJSON(w, http.StatusOK, j)
+	case j.Result == nil:
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("job %s did not finish yet", id))
+	default:
+		writeJSON(w, http.StatusOK, j.Result)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForJob waits until the job with the given ID is no longer queued or
+// running, and returns it.
+func waitForJob(t *testing.T, s *jobStore, id string) job {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		j, ok := s.Get(id)
+		if !ok {
+			t.Fatalf("job %s is gone", id)
+		}
+		if j.State != JobQueued && j.State != JobRunning {
+			return j
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return job{}
+}
+
+// waitForState waits until the job with the given ID is in state.
+func waitForState(t *testing.T, s *jobStore, id, state string) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if j, _ := s.Get(id); j.State == state {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not get %s", id, state)
+}
+
+func TestJobStoreLifecycle(t *testing.T) {
+	s, err := newJobStore(time.Minute, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request serveRequest
+		state   string
+		output  string
+	}{
+		{"output", serveRequest{Program: "++++++++[>++++++++<-]>+."}, JobDone, "A"},
+		{"input", serveRequest{Program: ",+.,+.", Input: "ab"}, JobDone, "bc"},
+		{"no output", serveRequest{Program: "+++"}, JobDone, ""},
+		{"fails", serveRequest{Program: "<"}, JobFailed, ""},
+		{"exceeds limit", serveRequest{Program: "+[]", Limits: sandboxLimits{Steps: 100}}, JobFailed, ""},
+	}
+	for _, test := range tests {
+		submitted := s.Submit(test.request)
+		if submitted.State != JobQueued || submitted.ID == "" {
+			t.Fatalf("%s: submitted job is %+v", test.name, submitted)
+		}
+		j := waitForJob(t, s, submitted.ID)
+		if j.State != test.state {
+			t.Errorf("%s: job got %s, expected %s", test.name, j.State, test.state)
+		}
+		if j.Finished == nil || j.Result == nil {
+			t.Fatalf("%s: job has no result", test.name)
+		}
+		if j.Result.Output != test.output {
+			t.Errorf("%s: got output %q, expected %q", test.name, j.Result.Output, test.output)
+		}
+		if (j.State == JobFailed) != (j.Result.Error != "") {
+			t.Errorf("%s: job got %s with error %q", test.name, j.State, j.Result.Error)
+		}
+	}
+}
+
+func TestJobStoreQueue(t *testing.T) {
+	s, err := newJobStore(time.Minute, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The only worker is busy with the first job, the others wait
+	endless := s.Submit(serveRequest{Program: "+[]"})
+	waitForState(t, s, endless.ID, JobRunning)
+	canceled := s.Submit(serveRequest{Program: "."})
+	next := s.Submit(serveRequest{Program: "+."})
+	time.Sleep(10 * time.Millisecond)
+	for _, id := range []string{canceled.ID, next.ID} {
+		if j, _ := s.Get(id); j.State != JobQueued {
+			t.Fatalf("job %s got %s while the worker is busy", id, j.State)
+		}
+	}
+
+	if !s.Cancel(canceled.ID) {
+		t.Fatalf("job %s not found", canceled.ID)
+	}
+	if j, _ := s.Get(canceled.ID); j.State != JobCanceled || j.Finished == nil || j.Result == nil {
+		t.Errorf("job canceled while queued is %+v", j)
+	}
+	if !s.Cancel(endless.ID) {
+		t.Fatalf("job %s not found", endless.ID)
+	}
+	if j := waitForJob(t, s, endless.ID); j.State != JobCanceled {
+		t.Errorf("job canceled while running got %s", j.State)
+	}
+
+	// The worker goes on with the next job, skipping the canceled one
+	if j := waitForJob(t, s, next.ID); j.State != JobDone || j.Result.Output != "\x01" {
+		t.Errorf("next job got %s with output %q", j.State, j.Result.Output)
+	}
+	if j, _ := s.Get(canceled.ID); j.State != JobCanceled {
+		t.Errorf("job canceled while queued got %s", j.State)
+	}
+
+	if s.Cancel("unknown") {
+		t.Errorf("canceled unknown job")
+	}
+	if _, ok := s.Get("unknown"); ok {
+		t.Errorf("got unknown job")
+	}
+}
+
+func TestJobStoreOrder(t *testing.T) {
+	s, err := newJobStore(time.Minute, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		ids = append(ids, s.Submit(serveRequest{Program: "+++[>+++<-]"}).ID)
+	}
+	var last time.Time
+	for _, id := range ids {
+		j := waitForJob(t, s, id)
+		if j.Finished.Before(last) {
+			t.Errorf("job %s finished before the job submitted before it", id)
+		}
+		last = *j.Finished
+	}
+}
+
+func TestJobStoreExpiry(t *testing.T) {
+	s, err := newJobStore(10*time.Millisecond, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := s.Submit(serveRequest{Program: "+"}).ID
+	waitForJob(t, s, id)
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := s.Get(id); !ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("job %s did not expire", id)
+}
+
+func TestJobStoreDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	// Without workers, jobs stay queued until the server restarts
+	s, err := newJobStore(time.Minute, 0, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.Submit(serveRequest{Program: "++.", Limits: sandboxLimits{Steps: 10}})
+	second := s.Submit(serveRequest{Program: ",.", Input: "x"})
+	canceled := s.Submit(serveRequest{Program: "."})
+	s.Cancel(canceled.ID)
+	s.db.Close()
+
+	s, err = newJobStore(time.Minute, 0, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.db.Close()
+	if len(s.queue) != 2 || s.queue[0].ID != first.ID || s.queue[1].ID != second.ID {
+		t.Errorf("jobs not queued again in the order submitted")
+	}
+	go s.work()
+	for id, output := range map[string]string{first.ID: "\x02", second.ID: "x"} {
+		if j := waitForJob(t, s, id); j.State != JobDone || j.Result.Output != output {
+			t.Errorf("job %s got %s with output %q, expected output %q", id, j.State, j.Result.Output, output)
+		}
+	}
+	if j, ok := s.Get(canceled.ID); !ok || j.State != JobCanceled {
+		t.Errorf("job canceled before the restart is %+v", j)
+	}
+	if j, _ := s.Get(first.ID); j.Request.Limits.Steps != 10 {
+		t.Errorf("job lost its limits, got %+v", j.Request.Limits)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// LimitError tells that a program got stopped for exceeding a limit.
+type LimitError struct {
+	// Name of the limit: steps, memory, time or output
+	Limit string `json:"limit"`
+	// The limit in steps, data cells, nanoseconds or bytes
+	Max uint64 `json:"max"`
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case "steps":
+		return fmt.Sprintf("program exceeds limit of %d steps", e.Max)
+	case "memory":
+		return fmt.Sprintf("program exceeds limit of %d data cells", e.Max)
+	case "time":
+		return fmt.Sprintf("program exceeds time limit of %s", time.Duration(e.Max))
+	case "output":
+		return fmt.Sprintf("program output exceeds limit of %d bytes", e.Max)
+	}
+	return fmt.Sprintf("program exceeds %s limit of %d", e.Limit, e.Max)
+}
+
+// limitedWriter passes on at most limit bytes to w. Beyond that, writes
+// fail unless truncate is set, in which case they are discarded after
+// printing a notice to diagnostics().
+type limitedWriter struct {
+	w         io.Writer
+	limit     int64
+	written   int64
+	truncate  bool
+	truncated bool
+}
+
+func (l *limitedWriter) Write(b []byte) (int, error) {
+	if l.written+int64(len(b)) <= l.limit {
+		n, err := l.w.Write(b)
+		l.written += int64(n)
+		return n, err
+	}
+
+	// Pass on what fits, writes may hold many bytes at once
+	n, err := l.w.Write(b[:l.limit-l.written])
+	l.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if !l.truncate {
+		return n, &LimitError{Limit: "output", Max: uint64(l.limit)}
+	}
+	if !l.truncated {
+		l.truncated = true
+		fmt.Fprintf(diagnostics(), "\nprogram output exceeds limit of %d bytes, discarding the rest\n", l.limit)
+	}
+	return len(b), nil
+}
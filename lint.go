@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+type lintFinding struct {
+	Offset  int
+	Message string
+}
+
+func isCancellingPair(a, b byte) bool {
+	switch {
+	case a == bf.InstIncrement && b == bf.InstDecrement,
+		a == bf.InstDecrement && b == bf.InstIncrement,
+		a == bf.InstMoveRight && b == bf.InstMoveLeft,
+		a == bf.InstMoveLeft && b == bf.InstMoveRight:
+		return true
+	}
+	return false
+}
+
+// lintSource looks for constructs which are valid but most likely not what
+// the author intended. Returns an error for unmatched loop instructions.
+func lintSource(source []byte) ([]lintFinding, error) {
+	if _, err := matchBrackets(source); err != nil {
+		return nil, err
+	}
+
+	// Only consider instructions, comments may be placed anywhere
+	offsets := []int{}
+	for i, b := range source {
+		if bf.IsInstruction(b) {
+			offsets = append(offsets, i)
+		}
+	}
+
+	findings := []lintFinding{}
+	for n, offset := range offsets {
+		instruction := source[offset]
+
+		if n == 0 && instruction == bf.InstLoopStart {
+			findings = append(findings, lintFinding{offset, "loop at the start of the program is never entered, the current cell is always zero"})
+		}
+
+		if n+1 < len(offsets) {
+			next := source[offsets[n+1]]
+			if instruction == bf.InstLoopEnd && next == bf.InstLoopStart {
+				findings = append(findings, lintFinding{offsets[n+1], "loop is never entered, the current cell is always zero after a loop"})
+			}
+			if isCancellingPair(instruction, next) {
+				findings = append(findings, lintFinding{offset, fmt.Sprintf("%q followed by %q has no effect", instruction, next)})
+			}
+		}
+	}
+
+	// Changes after the last input or output can't be observed
+	tail := len(offsets)
+	for tail > 0 {
+		instruction := source[offsets[tail-1]]
+		if instruction != bf.InstIncrement && instruction != bf.InstDecrement &&
+			instruction != bf.InstMoveRight && instruction != bf.InstMoveLeft {
+			break
+		}
+		tail--
+	}
+	if tail < len(offsets) {
+		findings = append(findings, lintFinding{offsets[tail], "instructions at the end of the program have no observable effect"})
+	}
+
+	return findings, nil
+}
+
+func writeLintFindings(w io.Writer, path string, source []byte, findings []lintFinding) {
+	for _, finding := range findings {
+		line, column := sourcePosition(source, finding.Offset)
+		fmt.Fprintf(w, "%s:%d:%d: %s\n", path, line, column, finding.Message)
+	}
+}
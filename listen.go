@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// acceptConnection listens on the TCP address addr until a single client
+// connects, and returns its connection.
+func acceptConnection(addr string) (net.Conn, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	fmt.Fprintf(diagnostics(), "listening on %s\n", l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(diagnostics(), "connection from %s\n", conn.RemoteAddr())
+	return conn, nil
+}
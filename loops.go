@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const (
+	loopKindClear        = "clear"
+	loopKindScan         = "scan"
+	loopKindCopy         = "copy"
+	loopKindMultiply     = "multiply"
+	loopKindUnclassified = "unclassified"
+)
+
+type loopInfo struct {
+	Start, End int
+	Depth      int
+
+	// Known is false if the net pointer movement of a single iteration can
+	// not be determined statically because of unbalanced inner loops.
+	Known bool
+	// Movement is the net pointer movement of a single iteration.
+	Movement int
+
+	Kind string
+}
+
+func (l *loopInfo) Balanced() bool {
+	return l.Known && l.Movement == 0
+}
+
+type loopBody struct {
+	movement  int
+	known     bool
+	innermost bool
+	io        bool
+	deltas    map[int]int
+}
+
+func analyzeLoopBody(source []byte, matches []int, start int) *loopBody {
+	body := &loopBody{
+		known:     true,
+		innermost: true,
+		deltas:    map[int]int{},
+	}
+
+	for i := start + 1; i < matches[start]; i++ {
+		switch source[i] {
+		case bf.InstMoveRight:
+			body.movement++
+		case bf.InstMoveLeft:
+			body.movement--
+		case bf.InstIncrement:
+			body.deltas[body.movement]++
+		case bf.InstDecrement:
+			body.deltas[body.movement]--
+		case bf.InstInput, bf.InstOutput:
+			body.io = true
+		case bf.InstLoopStart:
+			body.innermost = false
+			inner := analyzeLoopBody(source, matches, i)
+			if !inner.known || inner.movement != 0 {
+				body.known = false
+			}
+			body.io = body.io || inner.io
+			i = matches[i]
+		}
+	}
+
+	for offset, delta := range body.deltas {
+		if delta == 0 {
+			delete(body.deltas, offset)
+		}
+	}
+
+	return body
+}
+
+func (b *loopBody) kind() string {
+	if !b.innermost || b.io {
+		return loopKindUnclassified
+	}
+
+	switch {
+	case b.movement == 0 && len(b.deltas) == 1 && (b.deltas[0] == 1 || b.deltas[0] == -1):
+		return loopKindClear
+	case b.movement != 0 && len(b.deltas) == 0:
+		return loopKindScan
+	case b.movement == 0 && len(b.deltas) > 1 && (b.deltas[0] == 1 || b.deltas[0] == -1):
+		for offset, delta := range b.deltas {
+			if offset != 0 && delta != 1 {
+				return loopKindMultiply
+			}
+		}
+		return loopKindCopy
+	}
+
+	return loopKindUnclassified
+}
+
+// analyzeLoops returns information about every loop in source, ordered by
+// position.
+func analyzeLoops(source []byte) ([]*loopInfo, error) {
+	matches, err := matchBrackets(source)
+	if err != nil {
+		return nil, err
+	}
+
+	loops := []*loopInfo{}
+	depth := 0
+	for i, b := range source {
+		switch b {
+		case bf.InstLoopStart:
+			depth++
+			body := analyzeLoopBody(source, matches, i)
+			loops = append(loops, &loopInfo{
+				Start:    i,
+				End:      matches[i],
+				Depth:    depth,
+				Known:    body.known,
+				Movement: body.movement,
+				Kind:     body.kind(),
+			})
+		case bf.InstLoopEnd:
+			depth--
+		}
+	}
+
+	return loops, nil
+}
+
+// writeLoopReport writes a table describing every loop in source followed by
+// a summary of how many loops fall into each kind.
+func writeLoopReport(w io.Writer, source []byte) error {
+	loops, err := analyzeLoops(source)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "POSITION\tDEPTH\tMOVEMENT\tBALANCED\tKIND")
+
+	maxDepth := 0
+	balanced := 0
+	kinds := map[string]int{}
+	for _, loop := range loops {
+		line, column := sourcePosition(source, loop.Start)
+
+		movement := "?"
+		if loop.Known {
+			movement = fmt.Sprintf("%+d", loop.Movement)
+		}
+		isBalanced := "no"
+		if loop.Balanced() {
+			isBalanced = "yes"
+			balanced++
+		}
+		if loop.Depth > maxDepth {
+			maxDepth = loop.Depth
+		}
+		kinds[loop.Kind]++
+
+		fmt.Fprintf(tw, "%d:%d\t%d\t%s\t%s\t%s\n", line, column, loop.Depth, movement, isBalanced, loop.Kind)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "\n%d loops, maximum nesting depth %d, %d balanced, %d clear, %d scan, %d copy, %d multiply, %d unclassified\n",
+		len(loops), maxDepth, balanced,
+		kinds[loopKindClear], kinds[loopKindScan], kinds[loopKindCopy], kinds[loopKindMultiply], kinds[loopKindUnclassified])
+	return err
+}
@@ -1,236 +1,807 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
 
+	"github.com/icedream/gobfy/bf"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-const (
-	InstMoveRight byte = '>'
-	InstMoveLeft       = '<'
-	InstIncrement      = '+'
-	InstDecrement      = '-'
-	InstOutput         = '.'
-	InstInput          = ','
-	InstLoopStart      = '['
-	InstLoopEnd        = ']'
-)
-
 var (
-	app = kingpin.New("gobfy", "Yet another interpreter for Brainfuck programs.")
+	app = kingpin.New("gobfy", "Yet another interpreter for Brainfuck programs.").DefaultEnvars()
 
-	argInput = app.Arg("input", "The source file of the program to execute.").Required().ExistingFile()
+	flagExecute = app.Flag("execute", "Execute the given instructions instead of reading the program from a source file.").Short('e').PlaceHolder("PROGRAM").String()
 
-	flagDebug = app.Flag("debug", "Indicates whether to display information about the current state before executing each instruction.").Bool()
-)
+	flagInput = app.Flag("input", "Read the program's input from the given file instead of standard input, or from an endless stream of random bytes with random[:SEED].").Short('i').PlaceHolder("FILE").String()
 
-const (
-	DefaultPageSize = 1024
-)
+	flagListen = app.Flag("listen", "Wait for a single TCP connection on the given address, and connect the program's input and output to it.").PlaceHolder("[HOST]:PORT").String()
 
-type Closure struct {
-	Skip  bool
-	Root  bool
-	Start int
-}
+	flagExpect = app.Flag("expect", "Drive the program by the expect script in the given file, sending input once its output matches what the script expects. Fails if it does not within the script's timeout.").PlaceHolder("SCRIPT").ExistingFile()
+
+	flagInputString = app.Flag("input-string", "Use the given text as the program's input instead of standard input. Escape sequences like \\n or \\x00 are processed.").PlaceHolder("TEXT").String()
+
+	flagOutput = app.Flag("output", "Write the program's output to the given file instead of standard output, repeat to write to multiple files.").Short('o').PlaceHolder("FILE").Strings()
+
+	flagTee = app.Flag("tee", "Write the program's output to standard output as well as to the --output files.").Bool()
+
+	flagOutputMode = app.Flag("output-mode", "Whether to truncate the --output file or append to it.").Default("truncate").Enum("truncate", "append")
+
+	flagMkfifo = app.Flag("mkfifo", "Create the files given by --input and --output as named pipes if they do not exist yet, and remove them again after the program halts.").Bool()
+
+	flagFlush = app.Flag("flush", "When to write out buffered program output: after each byte (every-byte), after each line (newline), once the buffer is full (block) or only when the program halts (exit). Except for exit, output is also written out before waiting for input. The default is newline when writing to a terminal and block otherwise.").Default("auto").Enum("auto", "every-byte", "newline", "block", "exit")
+
+	flagOutputRate = app.Flag("output-rate", "Slow down the program's output to at most this many bytes per second.").PlaceHolder("BYTES").Uint()
+
+	flagInputRate = app.Flag("input-rate", "Slow down reading the program's input to at most this many bytes per second.").PlaceHolder("BYTES").Uint()
+
+	flagMaxOutput = app.Flag("max-output", "Maximum number of bytes a program may output, 0 for no limit.").PlaceHolder("1MB").Default("0").Bytes()
+
+	flagMaxOutputPolicy = app.Flag("max-output-policy", "Whether to abort the program or to discard the rest of its output when it exceeds --max-output.").Default("abort").Enum("abort", "truncate")
+
+	flagIO = app.Flag("io", "How the program's output bytes are written: as characters of ISO 8859-1 encoded as UTF-8 (latin1), as UTF-8 with incomplete sequences held back until complete (utf8), exactly as they are (binary), as hexdump (hex), or base64 encoded (base64).").Default("latin1").Enum("latin1", "utf8", "binary", "hex", "base64")
+
+	flagOutputEncoding = app.Flag("output-encoding", "Character encoding of the program's output, converted to UTF-8 for display: cp437, cp1252 or latin1.").PlaceHolder("ENCODING").Enum("cp437", "cp1252", "latin1")
+
+	flagInvalidUTF8 = app.Flag("invalid-utf8", "What to do with invalid UTF-8 in the program's output with --io=utf8: replace it by U+FFFD, drop it or write it as ISO 8859-1 characters.").Default("replace").Enum("replace", "drop", "latin1")
+
+	flagRawTTY = app.Flag("raw-tty", "Put the terminal into raw mode while the program runs, so that it reads each key as it is pressed without echoing it. Ctrl+C interrupts the program once it reads it.").Bool()
+
+	flagPTY = app.Flag("pty", "Run the program attached to a pseudo-terminal of its own, forwarding standard input and output, so that it behaves as if reading from and writing to a terminal.").Bool()
+
+	flagPrompt = app.Flag("prompt", "Prompt to print to standard error when the program waits for input from a terminal.").Default("input> ").String()
+
+	flagNonblockingInput = app.Flag("nonblocking-input", "Make the program's input instructions set the current cell to the value given by --no-input-value instead of waiting when there is no input available right now.").Bool()
+
+	flagNoInputValue = app.Flag("no-input-value", "Value input instructions read with --nonblocking-input if there is no input available.").Default("0").Uint8()
+
+	flagInputTimeout = app.Flag("input-timeout", "Give up waiting for input after this long, as selected by --input-timeout-policy.").PlaceHolder("DURATION").Duration()
+
+	flagInputTimeoutPolicy = app.Flag("input-timeout-policy", "Whether to abort the program after --input-timeout, or to treat the input as ended according to --eof.").Default("error").Enum("error", "eof")
+
+	flagUnbufferedInput = app.Flag("unbuffered-input", "Read the program's input a single byte at a time, so that input not read by the program is left for whatever runs next, such as the following command in a shell script. Can not be combined with --input-filter, --nonblocking-input or --input-timeout.").Bool()
+
+	flagInputFilter = app.Flag("input-filter", "Filter the program's input, repeat for multiple filters: translate CRLF line breaks to LF (crlf), or drop a line break at the end of input (trim-newline).").PlaceHolder("FILTER").Enums("crlf", "trim-newline")
+
+	flagEchoInput = app.Flag("echo-input", "Print each byte read by the program's input instructions to standard error, escaped.").Bool()
+
+	flagArgs = app.Flag("arg", "Pass an argument to the program, repeat for multiple arguments. They are NUL-terminated and written to the data cells starting at the first one or prepended to the input, see --args-to.").PlaceHolder("ARG").Strings()
+
+	flagArgsTo = app.Flag("args-to", "Where to pass arguments given by --arg.").Default("tape").Enum("tape", "input")
+
+	flagEnv = app.Flag("env", "Prepend a line NAME=value with the value of the given environment variable to the program's input, repeat for multiple variables.").PlaceHolder("NAME").Strings()
+
+	flagEOF = app.Flag("eof", "What the input instruction does at the end of input: fail, set the data cell to 0 or 255, or leave it unchanged. Defaults to error, except for example programs which expect unchanged.").PlaceHolder("error").Enum("error", "zero", "max", "unchanged")
+
+	flagBangInput = app.Flag("bang-input", "Treat everything after the first ! in a program as its input instead of as instructions.").Bool()
+
+	flagLang = app.Flag("lang", "Language of the program's source, bf or a dialect from the plugins directory.").Default(defaultDialect).HintAction(dialectNames).String()
+
+	flagExt = app.Flag("ext", "Enable an extension adding instructions, repeat for multiple extensions.").PlaceHolder("NAME").HintAction(bf.ExtensionNames).Strings()
+
+	flagTapes = app.Flag("tapes", "Number of tapes with the multitape extension.").Default("2").Int()
+
+	flagTapeTokens = app.Flag("tape-tokens", "Instructions switching to the previous and to the next tape with the multitape extension.").Default("{}").String()
+
+	flagAllowFile = app.Flag("allow-file", "Allow programs to open the given file, or any file within the given directory, with the fileio extension. Repeat to allow multiple paths.").PlaceHolder("PATH").Strings()
+
+	flagAllowConnect = app.Flag("allow-connect", "Allow programs to connect to the given HOST:PORT address, or any port on the given host, with the socket extension. Repeat to allow multiple addresses.").PlaceHolder("ADDRESS").Strings()
+
+	flagDevice = app.Flag("device", "Map data cells starting at the given one to a built-in device, repeat for multiple devices. Devices are: clock (6 cells, like the clock extension), random (1 cell) and screen (a character grid shown on the terminal, see --screen-size).").PlaceHolder("NAME@CELL").Strings()
+
+	flagScreenSize = app.Flag("screen-size", "Width and height of the screen device in characters.").Default("40x12").String()
+
+	flagStackDepth = app.Flag("stack-depth", "Maximum number of values on the stack of the stack extension.").Default("4096").Int()
+
+	flagEvalDepth = app.Flag("eval-depth", "Maximum nesting of code run by the eval extension's instruction.").Default("64").Int()
+
+	flagFixedClock = app.Flag("fixed-clock", "Start the time of the clock extension at the given RFC 3339 time or Unix time in seconds, advancing it by one millisecond per executed instruction instead of following the real time.").PlaceHolder("TIME").String()
+
+	flagSeed = app.Flag("seed", "Seed for the random numbers of the random extension, for reproducible runs.").PlaceHolder("N").String()
+
+	flagSelfModifying = app.Flag("self-modifying", "Place the program in the data cells left of where the data pointer starts, so that it can modify itself. Execution ends at the first data cell holding 0.").Bool()
+
+	flagStrict = app.Flag("strict", "Refuse to load programs containing anything but instructions and whitespace.").Bool()
+
+	flagFetchTimeout = app.Flag("fetch-timeout", "Maximum time to spend downloading a program given as URL.").Default("30s").Duration()
+
+	flagFetchMaxSize = app.Flag("fetch-max-size", "Maximum size of a program given as URL.").Default("16MiB").Bytes()
+
+	flagVerbose = app.Flag("verbose", "Log execution details to standard error, repeat for more detail: -v logs loop entries and exits, -vv every instruction, -vvv adds the surrounding data cells.").Short('v').Counter()
+
+	flagDebug = app.Flag("debug", "Same as -vv.").Hidden().Bool()
+
+	flagCoverage = app.Flag("coverage", "Print an instruction coverage report to standard error after the program halts.").Bool()
+
+	flagProfileListing = app.Flag("profile-listing", "Print the program source annotated with per-instruction execution counts to standard error after the program halts.").Bool()
 
-type Processor struct {
-	Data        []byte
-	DataPointer int
+	flagHeatmap = app.Flag("heatmap", "Print a heatmap of data cell write counts to standard error after the program halts.").Bool()
 
-	Debug bool
+	flagHeatmapPNG = app.Flag("heatmap-png", "Write a heatmap of data cell write counts as PNG image to the given file after the program halts.").PlaceHolder("FILE").String()
 
-	stdin *bufio.Reader
+	flagStepDelay = app.Flag("step-delay", "Pause for the given duration before each instruction and print the instruction and surrounding data cells to standard error.").PlaceHolder("50ms").Duration()
 
-	instructionPointer int
-	instructionBuffer  []byte
+	flagQuiet = app.Flag("quiet", "Do not print status messages such as the data cells after an interruption to standard error. Errors and requested reports are still printed.").Short('q').Bool()
 
-	closures []*Closure
+	flagNoProgress = app.Flag("no-progress", "Do not show a status line on standard error while a program runs for longer than a few seconds.").Bool()
+
+	flagNoColor = app.Flag("no-color", "Disable colors in diagnostic output even if standard error is a terminal.").Bool()
+
+	flagDebugger = app.Flag("debugger", "Pause before the first instruction and read debugger commands from the terminal.").Bool()
+
+	flagExitCell = app.Flag("exit-cell", "Exit with the value of the current data cell or the first data cell after the program halts.").PlaceHolder("current|first").Enum("current", "first")
+
+	flagEvents = app.Flag("events", "Write execution events, such as each instruction executed and each byte of output, as JSON lines to the given file.").PlaceHolder("FILE").String()
+
+	flagOTel = app.Flag("otel", "Export OpenTelemetry traces of loading and executing programs, and of the requests to the server, over OTLP/HTTP as configured by the standard OTEL_EXPORTER_OTLP_* environment variables.").Bool()
+
+	flagGIF = app.Flag("gif", "Record the data cells during execution and write them as animated GIF to the given file after the program halts.").PlaceHolder("FILE").String()
+
+	flagGIFInterval = app.Flag("gif-interval", "Number of executed instructions between two frames of the animated GIF.").Default("100").Uint64()
+
+	cmdRun      = app.Command("run", "Execute a program.").Default()
+	flagWatch   = cmdRun.Flag("watch", "Execute the program again whenever one of its source files changes.").Bool()
+	argRunInput = cmdRun.Arg("input", "The source files or URLs of the program to execute, or - for standard input. Multiple sources are concatenated in order.").Strings()
+
+	cmdDebug      = app.Command("debug", "Execute a program in the interactive debugger.")
+	argDebugInput = cmdDebug.Arg("input", "The source files or URLs of the program to execute, or - for standard input. Multiple sources are concatenated in order.").Strings()
+
+	cmdREPL = app.Command("repl", "Execute instructions line by line as they are typed in, printing the data cells after each line.")
+
+	cmdBench      = app.Command("bench", "Execute a program repeatedly with its output discarded and report timing statistics.")
+	flagBenchRuns = cmdBench.Flag("runs", "Number of times to execute the program.").Short('n').Default("10").Int()
+	argBenchInput = cmdBench.Arg("input", "The source files or URLs of the program to execute, or - for standard input. Multiple sources are concatenated in order.").Strings()
+
+	cmdBatch      = app.Command("batch", "Execute all programs in a directory, with input from the .in file next to each if present and output written to the .out file, and print a summary.")
+	argBatchInput = cmdBatch.Arg("directory", "The directory containing the programs.").Required().ExistingDir()
+
+	cmdPipe      = app.Command("pipe", "Execute programs concurrently, with the output of each one connected to the input of the next one like in a shell pipeline.")
+	argPipeInput = cmdPipe.Arg("input", "The source files or URLs of the programs to execute, in pipeline order.").Required().Strings()
+
+	cmdServe                   = app.Command("serve", "Run an HTTP server executing programs submitted by POST to /run, either as JSON object with program and input, or as source with the input given by the input query parameter. Responds with the output, steps and error as JSON object, subject to --max-output and the limits below, which may be lowered for a program by limits in the JSON object or by the max_steps, max_memory, max_output and timeout query parameters. Programs submitted the same way to /jobs run in the background instead: the response holds the job's ID, GET /jobs/ID returns its state, GET /jobs/ID/result its result once finished, and DELETE /jobs/ID cancels it. Jobs are queued and run by a pool of --workers. A WebSocket connection to /stream runs a program interactively: the first message holds the program, the following ones its input up to an empty message, and the output is sent as binary messages as it is produced, followed by a text message with the result. Metrics about the programs run are served at /metrics for Prometheus.")
+	flagServeHTTP              = cmdServe.Flag("http", "Address to listen on, unless systemd passes a socket named http, or a single socket not named grpc or ssh, by socket activation.").Default(":8080").PlaceHolder("[HOST]:PORT").String()
+	flagServeGRPC              = cmdServe.Flag("grpc", "Also serve the gRPC Executor service defined in bfpb/gobfy.proto on the given address, or on the socket named grpc passed by systemd by socket activation.").PlaceHolder("[HOST]:PORT").String()
+	flagServeMaxSteps          = cmdServe.Flag("max-steps", "Maximum number of instructions a program may execute, 0 for no limit.").Default("100000000").Uint64()
+	flagServeMaxMemory         = cmdServe.Flag("max-memory", "Maximum number of data cells a program may use, 0 for no limit.").Default("1MiB").Bytes()
+	flagServeTimeout           = cmdServe.Flag("timeout", "Maximum time a program may run, 0 for no limit.").Default("10s").Duration()
+	flagServeMaxRequestSize    = cmdServe.Flag("max-request-size", "Maximum size of a submitted program along with its input.").Default("1MiB").Bytes()
+	flagServeJobTimeout        = cmdServe.Flag("job-timeout", "Maximum time a program submitted as job may run, 0 for no limit.").Default("0").Duration()
+	flagServeJobTTL            = cmdServe.Flag("job-ttl", "How long to keep the results of jobs after they finished.").Default("1h").Duration()
+	flagServeWorkers           = cmdServe.Flag("workers", "Number of jobs to run at the same time, further jobs are queued.").Default(strconv.Itoa(runtime.NumCPU())).Int()
+	flagServeJobStore          = cmdServe.Flag("job-store", "Keep jobs in a database at the given path, so queued jobs and results survive restarts of the server.").PlaceHolder("PATH").String()
+	flagServeSessionTimeout    = cmdServe.Flag("session-timeout", "Maximum time a program run interactively over WebSocket may run, 0 for no limit.").Default("10m").Duration()
+	flagServeAllowOrigin       = cmdServe.Flag("allow-origin", "Allow pages of the given origin, like https://example.com, or of any origin for *, to connect to /stream besides those served by the server itself, may be repeated.").PlaceHolder("ORIGIN").Strings()
+	flagServeIsolate           = cmdServe.Flag("isolate", "Harden the server against programs abusing resources beyond the limits above, on Linux only: apply --isolate-memory and --isolate-cpu to the server process as a whole, and with extensions enabled, forbid opening network connections and changing the file system once the server is listening, which applies to the server itself as well and can not be combined with --otel.").Bool()
+	flagServeIsolateMemory     = cmdServe.Flag("isolate-memory", "Maximum memory of the server process with --isolate, enforced by its cgroup with --isolate-cgroup or by the limit on its data segment otherwise, 0 for no limit. This is shared by all programs running at the same time, one of them exceeding it fails the others or ends the server, while --max-memory limits each program on its own.").Default("0").Bytes()
+	flagServeIsolateCPU        = cmdServe.Flag("isolate-cpu", "Maximum number of CPUs the server process may use with --isolate, which needs --isolate-cgroup, 0 for no limit. This is shared by all programs running at the same time, one of them may slow down the others, while --timeout limits each program on its own.").Default("0").Float64()
+	flagServeIsolateCgroup     = cmdServe.Flag("isolate-cgroup", "Move the server process into a new cgroup below its own to apply the limits of --isolate, which needs cgroup v2 with the cgroup delegated to the user running the server, like systemd does with Delegate=yes.").Bool()
+	flagServeSSH               = cmdServe.Flag("ssh", "Also serve the programs given by --ssh-program interactively over SSH on the given address or on the socket named ssh passed by systemd by socket activation, with the input and output of each one connected to an SSH session. Clients choose a program by its name as command, the base name of its source without extension, or get the first one otherwise. Programs are subject to the same limits as those run over WebSocket.").PlaceHolder("[HOST]:PORT").String()
+	flagServeSSHPrograms       = cmdServe.Flag("ssh-program", "The source file or URL of a program to serve over SSH, may be repeated.").PlaceHolder("SOURCE").Strings()
+	flagServeSSHHostKey        = cmdServe.Flag("ssh-host-key", "The private key file identifying the SSH server, a new key gets generated at each start otherwise.").PlaceHolder("FILE").String()
+	flagServeSSHAuthorizedKeys = cmdServe.Flag("ssh-authorized-keys", "Only allow clients with a public key listed in the given file in the format of OpenSSH's authorized_keys, instead of anyone.").PlaceHolder("FILE").String()
+
+	cmdOneshot           = app.Command("oneshot", "Execute a program once with its input read from standard input and its output written to standard output, for inetd, CGI scripts and batch schedulers. Makes no assumptions about a terminal and flushes the output only when the program waits for input and when it halts. Exits with 0 once the program halted, 1 if it failed, 2 if it exceeded a limit, 64 for an invalid command line, 65 for an invalid program, 66 if the program could not be loaded, 74 if reading input or writing output failed, and 128 plus the signal's number when stopped by SIGINT or SIGTERM. As CGI script, the input is limited to CONTENT_LENGTH bytes. Errors are written to standard error unless --quiet.")
+	flagOneshotMaxSteps  = cmdOneshot.Flag("max-steps", "Maximum number of instructions the program may execute, 0 for no limit.").Default("0").Uint64()
+	flagOneshotMaxMemory = cmdOneshot.Flag("max-memory", "Maximum number of data cells the program may use, 0 for no limit.").Default("0").Bytes()
+	flagOneshotTimeout   = cmdOneshot.Flag("timeout", "Maximum time the program may run, 0 for no limit.").Default("0").Duration()
+	argOneshotInput      = cmdOneshot.Arg("input", "The source files or URLs of the program to execute. Multiple sources are concatenated in order.").Strings()
+
+	cmdCompile      = app.Command("compile", "Translate a program to C source code, written to standard output or the file given by --output.")
+	argCompileInput = cmdCompile.Arg("input", "The source file or URL of the program to translate, or - for standard input.").Required().String()
+
+	cmdFmt       = app.Command("fmt", "Reformat a program with loops broken up into indented lines.")
+	flagFmtWrite = cmdFmt.Flag("write", "Write the result back to the source file instead of standard output.").Short('w').Bool()
+	argFmtInput  = cmdFmt.Arg("input", "The source file or URL of the program to format, or - for standard input.").Required().String()
+
+	cmdLint      = app.Command("lint", "Report suspicious constructs in a program.")
+	argLintInput = cmdLint.Arg("input", "The source file or URL of the program to check, or - for standard input.").Required().String()
+
+	cmdCheck      = app.Command("check", "Validate programs without executing them, reporting errors, lint warnings and loop analysis results. Exits with a non-zero status if there were errors or warnings.")
+	argCheckInput = cmdCheck.Arg("input", "The source files or URLs of the programs to check, or - for standard input.").Required().Strings()
+
+	cmdCFG      = app.Command("cfg", "Print the control-flow graph of a program in Graphviz DOT format.")
+	argCFGInput = cmdCFG.Arg("input", "The source file or URL of the program to analyze, or - for standard input.").Required().String()
+
+	cmdExamples         = app.Command("examples", "Show or execute bundled example programs.")
+	cmdExamplesList     = cmdExamples.Command("list", "List the example programs.")
+	cmdExamplesShow     = cmdExamples.Command("show", "Print the source of an example program.")
+	argExamplesShowName = cmdExamplesShow.Arg("name", "The name of the example program.").Required().HintAction(exampleNames).String()
+	cmdExamplesRun      = cmdExamples.Command("run", "Execute an example program.")
+	argExamplesRunName  = cmdExamplesRun.Arg("name", "The name of the example program.").Required().HintAction(exampleNames).String()
+
+	cmdCompletion      = app.Command("completion", "Print a shell completion script. Load it with e.g. 'source <(gobfy completion bash)'.")
+	argCompletionShell = cmdCompletion.Arg("shell", "The shell to print the completion script for.").Required().HintOptions(completionShells...).Enum(completionShells...)
+
+	cmdLoops      = app.Command("loops", "Print nesting, pointer movement and classification of all loops in a program.")
+	argLoopsInput = cmdLoops.Arg("input", "The source file or URL of the program to analyze, or - for standard input.").Required().String()
+)
+
+// stdinPath stands in for a "-" path argument, which kingpin would otherwise
+// reject as an unknown short flag.
+const stdinPath = "<stdin>"
+
+// replaceStdinArgs returns args with "-" arguments replaced by stdinPath,
+// except for those given as value of a flag, like in -o -, which get joined
+// with their flag instead. Kingpin would reject either as unknown short flag
+// otherwise.
+func replaceStdinArgs(args []string) []string {
+	takesValue := map[string]bool{}
+	addFlags := func(flags []*kingpin.FlagModel) {
+		for _, flag := range flags {
+			if flag.IsBoolFlag() {
+				continue
+			}
+			takesValue["--"+flag.Name] = true
+			if flag.Short != 0 {
+				takesValue["-"+string(flag.Short)] = true
+			}
+		}
+	}
+	var addCommands func(commands []*kingpin.CmdModel)
+	addCommands = func(commands []*kingpin.CmdModel) {
+		for _, cmd := range commands {
+			addFlags(cmd.Flags)
+			addCommands(cmd.Commands)
+		}
+	}
+	model := app.Model()
+	addFlags(model.Flags)
+	addCommands(model.Commands)
+
+	replaced := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-":
+			arg = stdinPath
+		case arg == "--":
+			for _, arg := range args[i:] {
+				if arg == "-" {
+					arg = stdinPath
+				}
+				replaced = append(replaced, arg)
+			}
+			return replaced
+		case i+1 == len(args) || args[i+1] != "-":
+		case strings.HasPrefix(arg, "--"):
+			if takesValue[arg] {
+				arg, i = arg+"=-", i+1
+			}
+		case strings.HasPrefix(arg, "-") && takesValue["-"+arg[len(arg)-1:]]:
+			// Short flags can be combined, with the last one taking
+			// the value
+			arg, i = arg+"-", i+1
+		}
+		replaced = append(replaced, arg)
+	}
+	return replaced
 }
 
-func NewProcessor() *Processor {
-	return &Processor{
-		Data:  make([]byte, DefaultPageSize),
-		stdin: bufio.NewReader(os.Stdin),
-		closures: []*Closure{
-			&Closure{Root: true},
-		},
-		instructionBuffer: []byte{},
+// Whether standard input has been consumed for reading a program's source.
+var sourceFromStdin bool
+
+// Input following the programs loaded with --bang-input, nil if there was
+// none.
+var embeddedInput []byte
+
+// loadSource returns the program in the source file at path, without any
+// leading shebang line and translated from the language given by --lang.
+// With --bang-input, anything after the first ! is added to embeddedInput
+// instead.
+func loadSource(path string) ([]byte, error) {
+	input, err := loadRawSource(path)
+	if err != nil {
+		return nil, err
 	}
+	_, source := splitShebang(input)
+	return translateSource(splitSource(source)), nil
 }
 
-func (p *Processor) Stdin(r io.Reader) {
-	p.stdin = bufio.NewReader(r)
+func splitSource(source []byte) []byte {
+	if !*flagBangInput {
+		return source
+	}
+	code, input := splitBangInput(source)
+	if input != nil {
+		embeddedInput = append(embeddedInput, input...)
+	}
+	return code
+}
+
+func loadRawSource(path string) ([]byte, error) {
+	var input []byte
+	var err error
+	// Only fetched programs are limited in size, also once decompressed
+	var maxSize int64
+
+	switch {
+	case path == stdinPath || path == "-":
+		sourceFromStdin = true
+		input, err = ioutil.ReadAll(os.Stdin)
+	case isURL(path):
+		maxSize = int64(*flagFetchMaxSize)
+		input, err = fetchSource(path, *flagFetchTimeout, maxSize)
+	default:
+		// Open BF source code
+		input, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if input, err = decompressSource(input, maxSize); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return input, nil
 }
 
-func (p *Processor) ensureDataSize() {
-	if p.DataPointer >= len(p.Data) {
-		// Increase data array, lock to next page size
-		nextPagedSize := (1 + (p.DataPointer / DefaultPageSize)) * DefaultPageSize
-		p.Data = append(p.Data, make([]byte, 1+nextPagedSize-len(p.Data))...)
+func readSource(path string) []byte {
+	source, err := loadSource(path)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return source
 }
 
-func (p *Processor) Load(instructions []byte) {
-	p.instructionBuffer = instructions
-	p.instructionPointer = 0
+// loadProgram returns the concatenated contents of the source files at
+// paths, checking each of them first if strict mode is enabled.
+func loadProgram(paths []string) ([]byte, error) {
+	embeddedInput = nil
+	source := []byte{}
+	for _, path := range paths {
+		input, err := loadSource(path)
+		if err != nil {
+			return nil, err
+		}
+		if *flagStrict {
+			if err := checkStrict(input); err != nil {
+				return nil, fmt.Errorf("%s:%s", path, err)
+			}
+		}
+		source = append(source, input...)
+	}
+	return source, nil
 }
 
-func (p *Processor) Execute() {
-	for p.instructionPointer < len(p.instructionBuffer) {
-		instruction := p.instructionBuffer[p.instructionPointer]
+// programSource returns the program given by -e, or otherwise the
+// concatenated contents of the source files at paths. Without any paths, the
+// program is read from standard input unless it is a terminal.
+func programSource(paths []string) []byte {
+	_, span := tracer.Start(traceContext, "load")
+	defer span.End()
 
-		if p.Debug {
-			log.Printf("exec 0x%[2]x = %[1]q, data: 0x%[4]x = %[3]q (0x%[3]x), reserved data size: %[5]d B",
-				instruction,
-				p.instructionPointer,
-				p.Data[p.DataPointer],
-				p.DataPointer,
-				len(p.Data))
+	if *flagExecute != "" {
+		if len(paths) > 0 {
+			app.Fatalf("can not execute both a source file and a program given by -e")
+		}
+		source := translateSource(splitSource([]byte(*flagExecute)))
+		if *flagStrict {
+			if err := checkStrict(source); err != nil {
+				log.Fatal(err)
+			}
 		}
+		return source
+	}
 
-		switch instruction {
-		case InstMoveRight:
-			p.MoveRight()
-		case InstMoveLeft:
-			p.MoveLeft()
-		case InstDecrement:
-			p.Decrement()
-		case InstIncrement:
-			p.Increment()
-		case InstInput:
-			p.Input()
-		case InstOutput:
-			p.Output()
-		case InstLoopStart:
-			p.StartLoop()
-		case InstLoopEnd:
-			p.EndLoop()
-		default:
-			// Skip
+	if len(paths) == 0 {
+		if isTerminal(os.Stdin) {
+			app.Fatalf("no program given, pass a source file or use -e")
 		}
+		paths = []string{stdinPath}
+	}
 
-		p.instructionPointer++
+	source, err := loadProgram(paths)
+	if err != nil {
+		endSpan(span, err)
+		finishTracing()
+		log.Fatal(err)
 	}
+	span.SetAttributes(attribute.Int("gobfy.files", len(paths)), attribute.Int("gobfy.source_bytes", len(source)))
+	return source
 }
 
-func (p *Processor) Current() byte {
-	return p.Data[p.DataPointer]
-}
+// programInput returns what the program's input instructions should read
+// from. If the program's source has been read from standard input, there is
+// no input left unless given by --input or --input-string.
+func programInput() (io.Reader, error) {
+	if embeddedInput != nil {
+		if *flagInput != "" || *flagInputString != "" {
+			return nil, fmt.Errorf("can not combine input following ! in the program with --input or --input-string")
+		}
+		return bytes.NewReader(embeddedInput), nil
+	}
 
-func (p *Processor) Increment() {
-	if p.closures[0].Skip {
-		return
+	if *flagInputString != "" {
+		if *flagInput != "" {
+			return nil, fmt.Errorf("can not read input from both a file and --input-string")
+		}
+		input, err := unescape(*flagInputString)
+		if err != nil {
+			return nil, fmt.Errorf("--input-string: %s", err)
+		}
+		return bytes.NewReader(input), nil
+	}
+
+	if isRandomInput(*flagInput) {
+		return randomInput(*flagInput)
+	}
+	if *flagInput != "" && isFIFO(*flagInput) {
+		return &lazyFile{path: *flagInput, flag: os.O_RDONLY}, nil
+	}
+	if *flagInput != "" {
+		return os.Open(*flagInput)
 	}
 
-	p.Data[p.DataPointer]++
+	if sourceFromStdin {
+		return strings.NewReader(""), nil
+	}
+	return os.Stdin, nil
 }
 
-func (p *Processor) Decrement() {
-	if p.closures[0].Skip {
-		return
+// diagnostics returns where status messages go, which is standard error
+// unless they have been silenced by --quiet. Program output always goes to
+// standard output and never mixes with them.
+func diagnostics() io.Writer {
+	if *flagQuiet {
+		return ioutil.Discard
 	}
+	return os.Stderr
+}
 
-	p.Data[p.DataPointer]--
+// inputPrefix returns what the program reads before its actual input, which
+// are the environment variables selected by --env followed by the arguments
+// given by --arg with --args-to=input.
+func inputPrefix() []byte {
+	prefix := []byte{}
+	for _, name := range *flagEnv {
+		prefix = append(prefix, fmt.Sprintf("%s=%s\n", name, os.Getenv(name))...)
+	}
+	if *flagArgsTo == "input" {
+		prefix = append(prefix, encodeArgs(*flagArgs)...)
+	}
+	return prefix
 }
 
-func (p *Processor) MoveRight() {
-	if p.closures[0].Skip {
-		return
+// programOutput returns where the program's output instructions should
+// write to, which is standard output unless given by --output.
+func programOutput() (io.Writer, error) {
+	if len(*flagOutput) == 0 {
+		return os.Stdout, nil
 	}
 
-	p.DataPointer++
-	p.ensureDataSize()
-}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if *flagOutputMode == "append" {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
 
-func (p *Processor) MoveLeft() {
-	if p.closures[0].Skip {
-		return
+	files := outputFiles{}
+	for _, path := range *flagOutput {
+		if isFIFO(path) {
+			files = append(files, &lazyFile{path: path, flag: os.O_WRONLY})
+			continue
+		}
+		f, err := os.OpenFile(path, mode, 0666)
+		if err != nil {
+			files.Close()
+			return nil, err
+		}
+		files = append(files, f)
 	}
 
-	if p.DataPointer == 0 {
-		log.Fatal("can not move data pointer left, already at beginning of data")
+	if len(files) == 1 && !*flagTee {
+		return files[0], nil
 	}
+	return files, nil
+}
+
+// outputFiles writes to all --output files, and standard output with --tee.
+type outputFiles []io.WriteCloser
 
-	p.DataPointer--
+func (files outputFiles) Write(b []byte) (int, error) {
+	if *flagTee {
+		if _, err := os.Stdout.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	for _, f := range files {
+		if _, err := f.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
 }
 
-func (p *Processor) Output() {
-	if p.closures[0].Skip {
-		return
+func (files outputFiles) Close() error {
+	var err error
+	for _, f := range files {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Extensions enabled with --ext
+var enabledExtensions []*bf.Extension
+
+// newProcessor creates a processor configured by the global flags.
+func newProcessor() *bf.Processor {
+	p := bf.NewProcessor()
+	p.Stdin(os.Stdin)
+	p.Stdout(os.Stdout)
+
+	for _, ext := range enabledExtensions {
+		if err := p.Extend(ext); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := mapDevices(p, *flagDevice); err != nil {
+		log.Fatal(err)
+	}
+	for i, fn := range hostFunctions {
+		p.RegisterFunction(byte(i), fn)
+	}
+
+	p.DebugLevel = *flagVerbose
+	if *flagDebug && p.DebugLevel < bf.DebugLevelInstructions {
+		p.DebugLevel = bf.DebugLevelInstructions
+	}
+	p.DebugLog = &debugLogger{color: colorEnabled(os.Stderr, *flagNoColor)}
+	p.SelfModifying = *flagSelfModifying
+	if d := selectedDialect(); d != nil {
+		p.BitCells = d.BitCells
+	}
+
+	switch *flagEOF {
+	case "zero":
+		p.EOF = bf.EOFZero
+	case "max":
+		p.EOF = bf.EOFMax
+	case "unchanged":
+		p.EOF = bf.EOFUnchanged
 	}
 
-	fmt.Printf("%c", rune(p.Data[p.DataPointer]))
+	return p
 }
 
-func (p *Processor) Input() {
-	if p.closures[0].Skip {
-		return
+func compile(input []byte) {
+	if len(enabledExtensions) > 0 {
+		log.Fatal("can not compile programs using extensions")
+	}
+	if d := selectedDialect(); d != nil && d.BitCells {
+		log.Fatalf("can not compile %s programs", d.Name)
 	}
 
-	input, err := p.stdin.ReadByte()
+	w, err := programOutput()
 	if err != nil {
 		log.Fatal(err)
 	}
-	p.Data[p.DataPointer] = input
-}
-
-func (p *Processor) StartLoop() {
-	p.closures = append([]*Closure{
-		&Closure{
-			Start: p.instructionPointer,
-			Skip:  p.Data[p.DataPointer] == 0,
-		},
-	}, p.closures...)
+	if err := writeC(w, input); err != nil {
+		log.Fatal(err)
+	}
+	if c, ok := w.(io.Closer); ok && w != io.Writer(os.Stdout) {
+		if err := c.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
-func (p *Processor) EndLoop() {
-	if len(p.closures) <= 1 {
-		log.Fatal("unexpected end of closure, not in any closure")
+func format(path string) {
+	raw, err := loadRawSource(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	shebang, source := splitShebang(raw)
+	var input []byte
+	if *flagBangInput {
+		source, input = splitBangInput(source)
+	}
+	formatted, err := formatSource(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if input != nil {
+		formatted = append(append(formatted, '!'), input...)
+	}
+	if shebang != nil {
+		formatted = append(append(append([]byte{}, shebang...), '\n'), formatted...)
 	}
 
-	currentClosure := p.closures[0]
-
-	if !currentClosure.Skip {
-		if p.Data[p.DataPointer] > 0 {
-			p.instructionPointer = currentClosure.Start
-			return
+	if *flagFmtWrite && path != stdinPath && !isURL(path) {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Fatal(err)
 		}
+		if raw, err := ioutil.ReadFile(path); err != nil {
+			log.Fatal(err)
+		} else if bytes.HasPrefix(raw, gzipMagic) {
+			log.Fatalf("%s: can not write formatted program back to compressed source file", path)
+		}
+		if err := ioutil.WriteFile(path, formatted, info.Mode()); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	p.closures = p.closures[1:]
+	if _, err := os.Stdout.Write(formatted); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func (p *Processor) ExpectEnd() {
-	if len(p.closures) > 1 {
-		log.Fatal("unexpected end of instructions, still in a closure")
+func lint(path string) {
+	input := readSource(path)
+
+	findings, err := lintSource(input)
+	if err != nil {
+		log.Fatalf("%s:%s", path, err)
+	}
+
+	writeLintFindings(os.Stdout, path, input, findings)
+	if len(findings) > 0 {
+		os.Exit(1)
 	}
 }
 
-func main() {
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+// setup loads plugins and configuration files, and parses args as command
+// line, returning the command to run.
+func setup(args []string) (string, error) {
+	args = replaceStdinArgs(args)
 
-	inputFilePath := *argInput
+	if dir, err := pluginDir(); err == nil {
+		if err := loadPlugins(dir); err != nil {
+			return "", err
+		}
+	}
 
-	// Open BF source code
-	input, err := ioutil.ReadFile(inputFilePath)
+	app.HelpFlag.NoEnvar()
+	scopeCommandEnvars(app)
+	for _, path := range configFiles() {
+		if err := applyConfigFile(app, path); err != nil {
+			return "", err
+		}
+	}
+
+	command, err := app.Parse(args)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
-	p := NewProcessor()
+	if err := checkDialect(*flagLang); err != nil {
+		return "", err
+	}
+	if enabledExtensions, err = enableExtensions(dialectExtensions()); err != nil {
+		return "", err
+	}
+	if *flagBangInput && extensionTokens['!'] {
+		return "", fmt.Errorf("can not use --bang-input with an extension using ! as instruction")
+	}
+	if len(*flagArgs) > 0 && *flagArgsTo == "tape" && *flagSelfModifying {
+		return "", fmt.Errorf("can not pass arguments with --args-to=tape to programs modifying themselves, which are loaded into the same data cells, use --args-to=input")
+	}
+	// Either would take input beyond what the program reads
+	if *flagUnbufferedInput && len(*flagInputFilter) > 0 {
+		return "", fmt.Errorf("can not use --unbuffered-input with --input-filter, which holds back line breaks until more input follows")
+	}
+	if *flagUnbufferedInput && (*flagNonblockingInput || *flagInputTimeout > 0) {
+		return "", fmt.Errorf("can not use --unbuffered-input with --nonblocking-input or --input-timeout, which read input ahead in the background")
+	}
+	return command, nil
+}
 
-	if flagDebug != nil {
-		p.Debug = *flagDebug
+func main() {
+	command, err := setup(os.Args[1:])
+	if err != nil && oneshotRequested(os.Args[1:]) {
+		app.Errorf("%s", err)
+		os.Exit(oneshotUsage)
+	}
+	if err != nil {
+		app.Fatalf("%s", err)
+	}
+	if *flagOTel {
+		if err := setupTracing(command, command == cmdServe.FullCommand()); err != nil {
+			app.Fatalf("%s", err)
+		}
+		defer finishTracing()
+	}
+	if exportBindings(command) {
+		// Programs get run from JavaScript from here on
+		select {}
 	}
 
-	p.Load(input)
-	p.Execute()
-	p.ExpectEnd()
+	switch command {
+	case cmdRun.FullCommand():
+		if *flagWatch {
+			watch(*argRunInput, *flagDebugger)
+		} else {
+			runOrExit(programSource(*argRunInput), *flagDebugger)
+		}
+	case cmdDebug.FullCommand():
+		runOrExit(programSource(*argDebugInput), true)
+	case cmdREPL.FullCommand():
+		if err := repl(newProcessor()); err != nil {
+			log.Fatal(err)
+		}
+	case cmdBench.FullCommand():
+		bench(programSource(*argBenchInput), *flagBenchRuns)
+	case cmdBatch.FullCommand():
+		ok, err := batch(*argBatchInput)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case cmdPipe.FullCommand():
+		ok, err := pipeline(*argPipeInput)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case cmdServe.FullCommand():
+		log.Fatal(serve(*flagServeHTTP))
+	case cmdOneshot.FullCommand():
+		os.Exit(oneshot(*argOneshotInput, sandboxLimits{
+			Steps:   *flagOneshotMaxSteps,
+			Memory:  uint64(*flagOneshotMaxMemory),
+			Output:  uint64(*flagMaxOutput),
+			Timeout: *flagOneshotTimeout,
+		}))
+	case cmdCompile.FullCommand():
+		compile(readSource(*argCompileInput))
+	case cmdFmt.FullCommand():
+		format(*argFmtInput)
+	case cmdLint.FullCommand():
+		lint(*argLintInput)
+	case cmdCheck.FullCommand():
+		ok := true
+		for _, path := range *argCheckInput {
+			if !checkProgram(os.Stdout, path, readSource(path), *flagStrict) {
+				ok = false
+			}
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case cmdCFG.FullCommand():
+		if err := writeCFG(os.Stdout, readSource(*argCFGInput)); err != nil {
+			log.Fatal(err)
+		}
+	case cmdLoops.FullCommand():
+		if err := writeLoopReport(os.Stdout, readSource(*argLoopsInput)); err != nil {
+			log.Fatal(err)
+		}
+	case cmdExamplesList.FullCommand():
+		if err := writeExampleList(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case cmdExamplesShow.FullCommand():
+		source, err := exampleSource(*argExamplesShowName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(source)
+	case cmdExamplesRun.FullCommand():
+		source, err := exampleSource(*argExamplesRunName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *flagEOF == "" {
+			*flagEOF = "unchanged"
+		}
+		runOrExit(source, *flagDebugger)
+	case cmdCompletion.FullCommand():
+		if err := writeCompletionScript(os.Stdout, *argCompletionShell); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// histogram counts observations into buckets with the given upper bounds,
+// like a Prometheus histogram.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", name, h.count, name, h.sum, name, h.count)
+}
+
+// writeCounters writes a counter with a value for each value of label.
+func writeCounters(w io.Writer, name, help, label string, values map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, key, values[key])
+	}
+}
+
+// serverMetrics collects statistics about the programs run by the server,
+// served at /metrics in the Prometheus text format.
+type serverMetrics struct {
+	mu sync.Mutex
+
+	// Programs run by how they ended: ok, error, limit or canceled
+	programs        map[string]uint64
+	steps           uint64
+	limitViolations map[string]uint64
+	duration        *histogram
+	memory          *histogram
+}
+
+var metrics = &serverMetrics{
+	programs:        map[string]uint64{},
+	limitViolations: map[string]uint64{},
+	duration:        newHistogram(0.001, 0.01, 0.1, 0.5, 1, 5, 10, 60, 600),
+	memory:          newHistogram(1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216),
+}
+
+// record adds a program that ran for elapsed, executing steps instructions
+// with the given number of data cells, and ending as outcome. limit names
+// the limit it exceeded, if any.
+func (m *serverMetrics) record(outcome, limit string, steps uint64, elapsed time.Duration, cells int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.programs[outcome]++
+	if limit != "" {
+		m.limitViolations[limit]++
+	}
+	m.steps += steps
+	m.duration.observe(elapsed.Seconds())
+	m.memory.observe(float64(cells))
+}
+
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeCounters(w, "gobfy_programs_total", "Programs run, by how they ended.", "outcome", m.programs)
+	fmt.Fprintf(w, "# HELP gobfy_steps_total Instructions executed.\n# TYPE gobfy_steps_total counter\ngobfy_steps_total %d\n", m.steps)
+	writeCounters(w, "gobfy_limit_violations_total", "Programs stopped for exceeding a limit, by limit.", "limit", m.limitViolations)
+	m.duration.write(w, "gobfy_run_duration_seconds", "Time programs ran for.")
+	m.memory.write(w, "gobfy_memory_peak_cells", "Data cells used by programs.")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// Multiple tapes adds independent sets of data cells with a data pointer of
+// their own, and instructions to switch between them. The number of tapes
+// and the switching instructions are given by --tapes and --tape-tokens.
+var multitape = &bf.Extension{
+	Name:        "multitape",
+	Description: "Multiple tapes: { switches to the previous tape, } to the next one, wrapping around.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		count := *flagTapes
+		tokens := *flagTapeTokens
+		if count < 1 {
+			return nil, fmt.Errorf("need at least one tape")
+		}
+		if len(tokens) != 2 || tokens[0] == tokens[1] {
+			return nil, fmt.Errorf("need two different instructions to switch tapes, got %q", tokens)
+		}
+
+		// Tapes other than the current one, which is in use by the
+		// processor
+		tapes := make([][]byte, count)
+		pointers := make([]int, count)
+		current := 0
+		switchTape := func(p *bf.Processor, offset int) error {
+			next := (current + offset + count) % count
+			if tapes[next] == nil {
+				var err error
+				if tapes[next], err = p.NewData(bf.DefaultPageSize); err != nil {
+					return err
+				}
+			}
+			tapes[current], pointers[current] = p.SwapData(tapes[next], pointers[next])
+			current = next
+			return nil
+		}
+
+		return map[byte]func(p *bf.Processor) error{
+			tokens[0]: func(p *bf.Processor) error {
+				return switchTape(p, -1)
+			},
+			tokens[1]: func(p *bf.Processor) error {
+				return switchTape(p, 1)
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(multitape)
+}
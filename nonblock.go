@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// backgroundReader reads from r in the background, so that reading from it
+// need not block until r delivers. If nothing has been read yet, it returns
+// ErrNoInput right away with nonblocking set, and gives up after timeout if
+// that is not zero or once cancel gets closed.
+type backgroundReader struct {
+	nonblocking bool
+	timeout     time.Duration
+	// Returned when timing out
+	timeoutErr error
+	// Reading fails with bf.ErrInterrupted once closed
+	cancel <-chan struct{}
+
+	chunks chan []byte
+	errs   chan error
+	buf    []byte
+	err    error
+}
+
+func newBackgroundReader(r io.Reader) *backgroundReader {
+	b := &backgroundReader{
+		chunks: make(chan []byte),
+		errs:   make(chan error, 1),
+	}
+	go func() {
+		for {
+			chunk := make([]byte, 4096)
+			count, err := r.Read(chunk)
+			if count > 0 {
+				b.chunks <- chunk[:count]
+			}
+			if err != nil {
+				b.errs <- err
+				close(b.chunks)
+				return
+			}
+		}
+	}()
+	return b
+}
+
+func (b *backgroundReader) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		if b.nonblocking {
+			select {
+			case chunk, ok := <-b.chunks:
+				b.receive(chunk, ok)
+			default:
+				return 0, bf.ErrNoInput
+			}
+			continue
+		}
+
+		var timeout <-chan time.Time
+		if b.timeout > 0 {
+			timer := time.NewTimer(b.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case chunk, ok := <-b.chunks:
+			b.receive(chunk, ok)
+		case <-timeout:
+			return 0, b.timeoutErr
+		case <-b.cancel:
+			return 0, bf.ErrInterrupted
+		}
+	}
+
+	count := copy(p, b.buf)
+	b.buf = b.buf[count:]
+	return count, nil
+}
+
+func (b *backgroundReader) receive(chunk []byte, ok bool) {
+	if ok {
+		b.buf = chunk
+	} else {
+		b.err = <-b.errs
+	}
+}
+
+// inputTimeoutError returns what reading input fails with after
+// --input-timeout, as selected by --input-timeout-policy.
+func inputTimeoutError() error {
+	if *flagInputTimeoutPolicy == "eof" {
+		return io.EOF
+	}
+	return fmt.Errorf("no input within %s", *flagInputTimeout)
+}
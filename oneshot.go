@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// Exit statuses of the oneshot command, those of sysexits.h where there is
+// one. Stopped by a signal, it exits with 128 plus the signal's number.
+const (
+	oneshotOK = 0
+	// The program failed at runtime
+	oneshotFailed = 1
+	// The program exceeded --max-steps, --max-memory, --timeout or
+	// --max-output
+	oneshotLimit = 2
+	oneshotUsage = 64
+	// The program is invalid, like with unbalanced loops
+	oneshotInvalid = 65
+	// The program's source could not be loaded
+	oneshotNoSource = 66
+	// Reading standard input or writing standard output failed
+	oneshotIOError = 74
+)
+
+// oneshotRequested reports whether args select the oneshot command, even if
+// they are invalid otherwise.
+func oneshotRequested(args []string) bool {
+	ctx, _ := app.ParseContext(replaceStdinArgs(args))
+	return ctx != nil && ctx.SelectedCommand == cmdOneshot
+}
+
+// ioErrorRecorder remembers the first error reading from r or writing to w
+// other than the end of input, telling them apart from the program's own
+// errors.
+type ioErrorRecorder struct {
+	r   io.Reader
+	w   io.Writer
+	err error
+}
+
+func (e *ioErrorRecorder) record(err error) {
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *ioErrorRecorder) Read(b []byte) (int, error) {
+	n, err := e.r.Read(b)
+	e.record(err)
+	return n, err
+}
+
+func (e *ioErrorRecorder) Write(b []byte) (int, error) {
+	n, err := e.w.Write(b)
+	e.record(err)
+	return n, err
+}
+
+// cgiInput limits r to the request body announced by a web server running
+// gobfy as CGI script, which needs not be followed by the end of input.
+func cgiInput(r io.Reader) io.Reader {
+	if os.Getenv("GATEWAY_INTERFACE") == "" {
+		return r
+	}
+	n, err := strconv.ParseInt(os.Getenv("CONTENT_LENGTH"), 10, 64)
+	if err != nil {
+		return r
+	}
+	return io.LimitReader(r, n)
+}
+
+// oneshotSource returns the program given by -e or loaded from paths, and
+// the exit status if it can not be run.
+func oneshotSource(paths []string) ([]byte, int, error) {
+	var source []byte
+	switch {
+	case *flagExecute != "" && len(paths) > 0:
+		return nil, oneshotUsage, fmt.Errorf("can not execute both a source file and a program given by -e")
+	case *flagExecute != "":
+		source = translateSource(splitSource([]byte(*flagExecute)))
+		if *flagStrict {
+			if err := checkStrict(source); err != nil {
+				return nil, oneshotInvalid, err
+			}
+		}
+	case len(paths) == 0:
+		return nil, oneshotUsage, fmt.Errorf("no program given, pass a source file or use -e")
+	default:
+		for _, path := range paths {
+			if path == stdinPath {
+				return nil, oneshotUsage, fmt.Errorf("can not read the program from standard input, which is its input")
+			}
+		}
+		embeddedInput = nil
+		for _, path := range paths {
+			input, err := loadSource(path)
+			if err != nil {
+				return nil, oneshotNoSource, err
+			}
+			if *flagStrict {
+				if err := checkStrict(input); err != nil {
+					return nil, oneshotInvalid, fmt.Errorf("%s:%s", path, err)
+				}
+			}
+			source = append(source, input...)
+		}
+	}
+	if _, err := matchBrackets(source); err != nil {
+		return nil, oneshotInvalid, err
+	}
+	return source, oneshotOK, nil
+}
+
+// oneshot runs the program loaded from paths once, with its input read from
+// file descriptor 0 and its output written to file descriptor 1, and returns
+// the exit status. Unlike run, it makes no assumptions about a terminal, the
+// output gets flushed only when the program waits for input and when it
+// halts, and any failure has its own exit status.
+func oneshot(paths []string, limits sandboxLimits) int {
+	ignoreSIGPIPE()
+	status := diagnostics()
+	fail := func(code int, err error) int {
+		fmt.Fprintf(status, "%s: %s\n", app.Name, err)
+		return code
+	}
+
+	source, code, err := oneshotSource(paths)
+	if err != nil {
+		return fail(code, err)
+	}
+
+	stdio := &ioErrorRecorder{r: os.Stdin, w: os.Stdout}
+	var in io.Reader = stdio
+	if embeddedInput != nil {
+		in = io.MultiReader(bytes.NewReader(embeddedInput), stdio)
+	}
+	buffered := bufio.NewWriter(stdio)
+	out, flushOutput, err := encodeOutput(buffered)
+	if err != nil {
+		return fail(oneshotUsage, err)
+	}
+	if limits.Output > 0 {
+		out = &limitedWriter{
+			w:        out,
+			limit:    int64(limits.Output),
+			truncate: *flagMaxOutputPolicy == "truncate",
+		}
+	}
+
+	p := newProcessor()
+	p.DebugLog = &debugLogger{}
+	p.ByteOutput = *flagIO != "latin1" || *flagOutputEncoding != ""
+	p.Stdin(filterInput(cgiInput(in)))
+	p.Stdout(out)
+	// Reading input can not be interrupted, the program gets stopped
+	// while executing otherwise
+	var waiting int32
+	p.OnInputWait(func(p *bf.Processor) {
+		buffered.Flush()
+		atomic.StoreInt32(&waiting, 1)
+	})
+	p.OnInput(func(p *bf.Processor, b byte, err error) {
+		atomic.StoreInt32(&waiting, 0)
+	})
+	p.Load(source)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signaled := make(chan int, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		var s os.Signal
+		select {
+		case s = <-signals:
+		case <-ctx.Done():
+			return
+		}
+		code := 128 + int(syscall.SIGTERM)
+		if s, ok := s.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		if atomic.LoadInt32(&waiting) == 1 {
+			os.Exit(code)
+		}
+		signaled <- code
+		cancel()
+	}()
+	stop := limitExecution(ctx, p, limits)
+
+	err = p.Execute()
+	// Execution fails in whichever way when stopped while waiting for input
+	err = stop.Result(err)
+	if err == nil {
+		err = p.ExpectEnd()
+	}
+	if err == nil {
+		err = p.Flush()
+	}
+	if err == nil {
+		err = flushOutput()
+	}
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+
+	var limit *LimitError
+	switch {
+	case err == nil:
+		return oneshotOK
+	case err == context.Canceled:
+		return <-signaled
+	case errors.As(err, &limit):
+		return fail(oneshotLimit, err)
+	case stdio.err != nil:
+		return fail(oneshotIOError, stdio.err)
+	default:
+		return fail(oneshotFailed, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// pipeline runs the programs in the source files at paths concurrently, with
+// the output of each connected to the input of the next one. The first one
+// reads the program input, the last one writes the program output. Once a
+// program halts, the next one reads the end of input; once it fails, the
+// previous one gets to halt as if its output was closed. Returns whether all
+// programs halted normally.
+func pipeline(paths []string) (bool, error) {
+	if len(paths) == 0 {
+		return false, fmt.Errorf("no programs given")
+	}
+	sources := [][]byte{}
+	var firstInput []byte
+	for i, path := range paths {
+		source, err := loadProgram([]string{path})
+		if err != nil {
+			return false, err
+		}
+		// Loading resets embeddedInput, only the first program reads the
+		// program input it may give
+		switch {
+		case i == 0:
+			firstInput = embeddedInput
+		case embeddedInput != nil:
+			return false, fmt.Errorf("%s: can not use input following ! in a program reading the output of the one before it", path)
+		}
+		sources = append(sources, source)
+	}
+	embeddedInput = firstInput
+
+	in, err := programInput()
+	if err != nil {
+		return false, err
+	}
+	if c, ok := in.(io.Closer); ok && in != io.Reader(os.Stdin) {
+		defer c.Close()
+	}
+	out, err := programOutput()
+	if err != nil {
+		return false, err
+	}
+	if c, ok := out.(io.Closer); ok && out != io.Writer(os.Stdout) {
+		defer c.Close()
+	}
+	out, flushOutput, err := encodeOutput(out)
+	if err != nil {
+		return false, err
+	}
+
+	processors := make([]*bf.Processor, len(sources))
+	readers := make([]*io.PipeReader, len(sources))
+	writers := make([]*io.PipeWriter, len(sources))
+	for i := range sources {
+		p := newProcessor()
+		if i == 0 {
+			p.Stdin(filterInput(in))
+		} else {
+			p.Stdin(readers[i])
+		}
+		if i == len(sources)-1 {
+			p.ByteOutput = *flagIO != "latin1" || *flagOutputEncoding != ""
+			p.Stdout(out)
+		} else {
+			// Pass on bytes as they are between programs
+			p.ByteOutput = true
+			readers[i+1], writers[i] = io.Pipe()
+			p.Stdout(writers[i])
+		}
+		p.Load(sources[i])
+		processors[i] = p
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		<-interrupts
+		for _, p := range processors {
+			p.Stop()
+		}
+		// Programs may be blocked waiting for input, give up on a clean
+		// stop if interrupted a second time
+		<-interrupts
+		os.Exit(130)
+	}()
+
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for i, p := range processors {
+		wg.Add(1)
+		go func(i int, p *bf.Processor) {
+			defer wg.Done()
+			err := p.Execute()
+			if err == nil {
+				err = p.ExpectEnd()
+			}
+			if err == nil {
+				err = p.Flush()
+			}
+			if err == nil && i == len(processors)-1 {
+				err = flushOutput()
+			}
+			// The next program stops reading from a program that is gone
+			// as if its output got closed, like SIGPIPE would
+			if err == io.ErrClosedPipe {
+				err = nil
+			}
+			errs[i] = err
+
+			if writers[i] != nil {
+				writers[i].Close()
+			}
+			if readers[i] != nil {
+				readers[i].Close()
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	ok := true
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, bf.ErrInterrupted):
+			ok = false
+			fmt.Fprintf(diagnostics(), "\n%s interrupted: %s\n", paths[i], describeState(processors[i], sources[i]))
+		default:
+			ok = false
+			fmt.Fprintf(os.Stderr, "%s: %s\n", paths[i], err)
+		}
+	}
+	return ok, nil
+}
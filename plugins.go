@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"github.com/icedream/gobfy/bf"
+	"gopkg.in/yaml.v3"
+)
+
+// pluginDir returns the directory plugins get loaded from at startup.
+func pluginDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gobfy", "plugins"), nil
+}
+
+// loadPlugins loads the plugins in dir: dialects for --lang from YAML or
+// JSON files, and extensions for --ext from Go plugins. A missing dir is not
+// an error.
+func loadPlugins(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) || noFileSystem(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+
+		var err error
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+			err = loadDialect(path, name)
+		case ".so":
+			err = loadExtensionPlugin(path, name)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("plugin %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// loadDialect registers the dialect defined in the file at path, named name
+// unless the file says otherwise. Being a subset of YAML, JSON works too.
+func loadDialect(path, name string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var definition struct {
+		Name        string            `yaml:"name"`
+		Description string            `yaml:"description"`
+		Tokens      map[string]string `yaml:"tokens"`
+		BitCells    bool              `yaml:"bit-cells"`
+		Alphabet    string            `yaml:"alphabet"`
+		Extensions  []string          `yaml:"extensions"`
+	}
+	if err := yaml.Unmarshal(data, &definition); err != nil {
+		return err
+	}
+	if definition.Name != "" {
+		name = definition.Name
+	}
+	return registerDialect(&Dialect{
+		Name:        name,
+		Description: definition.Description,
+		Tokens:      definition.Tokens,
+		BitCells:    definition.BitCells,
+		Alphabet:    definition.Alphabet,
+		Extensions:  definition.Extensions,
+	})
+}
+
+// loadExtensionPlugin loads the Go plugin at path. Plugins importing package
+// bf register their extensions themselves by calling bf.RegisterExtension
+// from an init function, with instructions getting the whole Processor.
+// Simpler plugins, not depending on package bf, are registered as extension
+// named name, with instructions getting the data cells and the data pointer:
+//
+//	var Description = "..."
+//	var Instructions = map[byte]func(cells *[]byte, pointer *int) error{...}
+//
+// Instructions may move the data pointer and grow the data cells, with the
+// pointer kept within them.
+func loadExtensionPlugin(path, name string) error {
+	registered := len(bf.ExtensionNames())
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+
+	symbol, err := plug.Lookup("Instructions")
+	if err != nil {
+		if len(bf.ExtensionNames()) > registered {
+			// Registered its extensions with bf.RegisterExtension
+			return nil
+		}
+		return err
+	}
+	instructions, ok := symbol.(*map[byte]func(cells *[]byte, pointer *int) error)
+	if !ok {
+		return fmt.Errorf("Instructions has type %T, expected map[byte]func(cells *[]byte, pointer *int) error", symbol)
+	}
+	description := ""
+	if symbol, err := plug.Lookup("Description"); err == nil {
+		if d, ok := symbol.(*string); ok {
+			description = *d
+		}
+	}
+
+	if _, ok := bf.LookupExtension(name); ok {
+		return fmt.Errorf("extension %s is already defined", name)
+	}
+	bf.RegisterExtension(&bf.Extension{
+		Name:        name,
+		Description: description,
+		New: func() (map[byte]func(p *bf.Processor) error, error) {
+			ops := map[byte]func(p *bf.Processor) error{}
+			for token, instruction := range *instructions {
+				instruction := instruction
+				ops[token] = func(p *bf.Processor) error {
+					if err := instruction(&p.Data, &p.DataPointer); err != nil {
+						return err
+					}
+					if p.DataPointer < 0 || p.DataPointer >= len(p.Data) {
+						return fmt.Errorf("extension %s moved the data pointer to %d, outside of the data cells", name, p.DataPointer)
+					}
+					return nil
+				}
+			}
+			return ops, nil
+		},
+	})
+	return nil
+}
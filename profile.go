@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// writeProfileListing writes source annotated with per-instruction execution
+// counts in a gutter on the left. Source lines are split up into runs of
+// instructions that share the same count, each run keeping its original
+// column so that the program layout stays recognizable.
+func writeProfileListing(w io.Writer, source []byte, hits []uint64) error {
+	var maxHits uint64
+	for i, b := range source {
+		if isProgramInstruction(b) && hits[i] > maxHits {
+			maxHits = hits[i]
+		}
+	}
+	gutterWidth := len(strconv.FormatUint(maxHits, 10))
+
+	bw := bufio.NewWriter(w)
+
+	writeRow := func(count string, indent, segment []byte) {
+		fmt.Fprintf(bw, "%*s | %s%s\n", gutterWidth, count, indent, segment)
+	}
+
+	offset := 0
+	for _, rawLine := range bytes.SplitAfter(source, []byte{'\n'}) {
+		if len(rawLine) == 0 {
+			break
+		}
+		line := bytes.TrimRight(rawLine, "\r\n")
+
+		segmentStart := 0
+		segmentHits := uint64(0)
+		segmentHasInstructions := false
+		indent := []byte{}
+
+		for i, b := range line {
+			if !isProgramInstruction(b) {
+				continue
+			}
+			count := hits[offset+i]
+			if segmentHasInstructions && count != segmentHits {
+				writeRow(strconv.FormatUint(segmentHits, 10), indent, line[segmentStart:i])
+				for _, c := range line[segmentStart:i] {
+					if c == '\t' {
+						indent = append(indent, '\t')
+					} else {
+						indent = append(indent, ' ')
+					}
+				}
+				segmentStart = i
+			}
+			segmentHits = count
+			segmentHasInstructions = true
+		}
+
+		if segmentHasInstructions {
+			writeRow(strconv.FormatUint(segmentHits, 10), indent, line[segmentStart:])
+		} else {
+			writeRow("", indent, line)
+		}
+
+		offset += len(rawLine)
+	}
+
+	return bw.Flush()
+}
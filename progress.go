@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const (
+	progressDelay    = 3 * time.Second
+	progressInterval = 250 * time.Millisecond
+)
+
+// showProgress keeps a status line with the number of executed steps on w
+// once the program has been running for a while. The line is written from
+// the goroutine executing the program to avoid racing it. The returned
+// function stops updating and clears the line.
+func showProgress(w io.Writer, p *bf.Processor) (stop func()) {
+	var due int32
+	ticker := time.NewTicker(progressInterval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				atomic.StoreInt32(&due, 1)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	shown := false
+	p.OnStep(func(p *bf.Processor) {
+		if atomic.LoadInt32(&due) == 0 {
+			return
+		}
+		atomic.StoreInt32(&due, 0)
+
+		elapsed := time.Since(start)
+		if elapsed < progressDelay {
+			return
+		}
+		shown = true
+		fmt.Fprintf(w, "\r\x1b[K%d steps, %.0f steps/s, %s elapsed",
+			p.Steps(), float64(p.Steps())/elapsed.Seconds(), elapsed.Round(time.Second))
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+			if shown {
+				fmt.Fprint(w, "\r\x1b[K")
+			}
+		})
+	}
+}
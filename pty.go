@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/icedream/gobfy/bf"
+	"golang.org/x/term"
+)
+
+// ptySession connects a program to a pseudo-terminal, whose line
+// discipline takes care of echoing and line editing like for programs
+// reading from a terminal. Input gets forwarded from standard input, and
+// output to standard output.
+type ptySession struct {
+	master, slave *os.File
+	// Closed once all output has been forwarded
+	done    chan struct{}
+	restore func()
+}
+
+// startPTY allocates a pseudo-terminal for the program running on p. The
+// terminal on standard input, if any, is put into raw mode meanwhile, with
+// Ctrl+C stopping p.
+func startPTY(p *bf.Processor) (*ptySession, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	s := &ptySession{master: master, slave: slave, done: make(chan struct{}), restore: func() {}}
+
+	interactive := isTerminal(os.Stdin)
+	if interactive {
+		fd := int(os.Stdin.Fd())
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			master.Close()
+			slave.Close()
+			return nil, err
+		}
+		s.restore = func() { term.Restore(fd, state) }
+	}
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			for _, b := range buf[:n] {
+				if interactive && b == 0x03 {
+					p.Stop()
+				}
+			}
+			if _, err := master.Write(buf[:n]); err != nil {
+				return
+			}
+			if err != nil {
+				// Ctrl+D, so that the program reads the end of input
+				// in canonical mode
+				master.Write([]byte{0x04})
+				return
+			}
+		}
+	}()
+	go func() {
+		io.Copy(os.Stdout, master)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// Close waits for the program's output to be forwarded, then releases the
+// pseudo-terminal and restores the terminal on standard input.
+func (s *ptySession) Close() {
+	// Reading from the master fails once the slave is closed and all
+	// output has been read
+	s.slave.Close()
+	<-s.done
+	s.master.Close()
+	s.restore()
+}
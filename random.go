@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// The random extension adds an instruction for getting random numbers,
+// seeded by --seed to make runs reproducible. The same numbers are available
+// without extra instructions from the random device.
+var random = &bf.Extension{
+	Name:        "random",
+	Description: "Random numbers: ? sets the current cell to a random value.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		rng, err := newRandomSource()
+		if err != nil {
+			return nil, err
+		}
+
+		return map[byte]func(p *bf.Processor) error{
+			'?': func(p *bf.Processor) error {
+				p.Data[p.DataPointer] = byte(rng.Intn(256))
+				p.CellWritten()
+				return nil
+			},
+		}, nil
+	},
+}
+
+// newRandomSource returns a random number generator seeded by --seed, or
+// by the current time if not given.
+func newRandomSource() (*rand.Rand, error) {
+	seed := time.Now().UnixNano()
+	if *flagSeed != "" {
+		var err error
+		if seed, err = strconv.ParseInt(*flagSeed, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid seed %q", *flagSeed)
+		}
+	}
+	return rand.New(rand.NewSource(seed)), nil
+}
+
+// isRandomInput reports whether the --input value spec selects random input
+// rather than a file.
+func isRandomInput(spec string) bool {
+	return spec == "random" || strings.HasPrefix(spec, "random:")
+}
+
+// randomInput returns an endless stream of random bytes for --input, seeded
+// by the number following "random:" in spec, or by the current time.
+func randomInput(spec string) (io.Reader, error) {
+	seed := time.Now().UnixNano()
+	if parts := strings.SplitN(spec, ":", 2); len(parts) == 2 {
+		var err error
+		if seed, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid seed for random input %q", parts[1])
+		}
+	}
+	return rand.New(rand.NewSource(seed)), nil
+}
+
+// randomDevice is a data cell holding a new random value whenever read.
+type randomDevice struct {
+	rng *rand.Rand
+}
+
+func (d randomDevice) ReadCell(p *bf.Processor, offset int) byte {
+	return byte(d.rng.Intn(256))
+}
+
+func (d randomDevice) WriteCell(p *bf.Processor, offset int, value byte) {}
+
+func init() {
+	bf.RegisterExtension(random)
+	registerDevice("random", func() (bf.Device, int, error) {
+		rng, err := newRandomSource()
+		return randomDevice{rng}, 1, err
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// pacer spaces out bytes to a rate in bytes per second.
+type pacer struct {
+	rate  int
+	start time.Time
+	count int64
+}
+
+// wait blocks until the next byte is due.
+func (p *pacer) wait() {
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	due := p.start.Add(time.Duration(p.count) * time.Second / time.Duration(p.rate))
+	time.Sleep(time.Until(due))
+	p.count++
+}
+
+// rateWriter passes on bytes to w at a rate of at most rate bytes per
+// second.
+type rateWriter struct {
+	w io.Writer
+	pacer
+}
+
+func newRateWriter(w io.Writer, rate int) *rateWriter {
+	return &rateWriter{w: w, pacer: pacer{rate: rate}}
+}
+
+func (r *rateWriter) Write(b []byte) (int, error) {
+	for i := range b {
+		r.wait()
+		if _, err := r.w.Write(b[i : i+1]); err != nil {
+			return i, err
+		}
+	}
+	return len(b), nil
+}
+
+// rateReader reads from r at a rate of at most rate bytes per second.
+type rateReader struct {
+	r io.Reader
+	pacer
+}
+
+func newRateReader(r io.Reader, rate int) *rateReader {
+	return &rateReader{r: r, pacer: pacer{rate: rate}}
+}
+
+func (r *rateReader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	r.wait()
+	return r.r.Read(b[:1])
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/icedream/gobfy/bf"
+	"golang.org/x/term"
+)
+
+// makeRawTerminal puts the terminal on standard input into raw mode, so
+// that the program gets to read each key as it is pressed without it being
+// echoed. The returned function restores the previous mode.
+func makeRawTerminal() (restore func(), err error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("can not use raw terminal mode, standard input is not a terminal")
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		term.Restore(fd, state)
+	}, nil
+}
+
+// crlfWriter translates line feeds to carriage return and line feed, which
+// the terminal stops doing on its own in raw mode.
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(b []byte) (int, error) {
+	if _, err := c.w.Write(bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// interruptOnCtrlC stops the processor when the program reads a Ctrl+C,
+// which does not raise SIGINT in raw mode.
+func interruptOnCtrlC(p *bf.Processor, b byte, err error) {
+	if err == nil && b == 0x03 {
+		p.Stop()
+	}
+}
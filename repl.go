@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// repl reads lines of instructions from standard input and executes each of
+// them on the same processor, printing the data cells around the data
+// pointer afterwards. Instructions reading input consume the lines following
+// the one being executed, unless their input is given by --input or
+// --input-string.
+func repl(p *bf.Processor) error {
+	in := bufio.NewReader(consoleInput(os.Stdin))
+	p.Stdin(in)
+	if *flagInput != "" || *flagInputString != "" {
+		r, err := programInput()
+		if err != nil {
+			return err
+		}
+		if c, ok := r.(io.Closer); ok {
+			defer c.Close()
+		}
+		p.Stdin(filterInput(r))
+	}
+	status := diagnostics()
+
+	for {
+		fmt.Fprint(status, "bf> ")
+		line, err := in.ReadString('\n')
+		if line == "" && err == io.EOF {
+			fmt.Fprintln(status)
+			return p.Flush()
+		}
+
+		code := []byte(line)
+		if _, err := matchBrackets(code); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		p.Load(code)
+		if err := p.Execute(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			// Drop loops left open by the failed line
+			p.ResetLoops()
+		}
+		fmt.Fprintln(status, formatTapeWindow(p, 8))
+	}
+}
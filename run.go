@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// echoInput prints a byte read by the program, or why reading failed.
+func echoInput(p *bf.Processor, b byte, err error) {
+	switch err {
+	case bf.ErrNoInput:
+		// Would be printed over and over by programs polling for input
+	case nil:
+		fmt.Fprintf(os.Stderr, "input %q\n", string([]byte{b}))
+	case io.EOF:
+		fmt.Fprintln(os.Stderr, "input EOF")
+	default:
+		fmt.Fprintf(os.Stderr, "input error: %s\n", err)
+	}
+}
+
+// run executes the program in source on p, with diagnostics and reports as
+// requested by the global flags. Returns ErrInterrupted if execution got
+// stopped, either by calling p.Stop or by SIGINT.
+func run(p *bf.Processor, source []byte, withDebugger bool) error {
+	if *flagMkfifo {
+		paths := append([]string{}, *flagOutput...)
+		if *flagInput != "" && !isRandomInput(*flagInput) {
+			paths = append(paths, *flagInput)
+		}
+		remove, err := makeFIFOs(paths)
+		if err != nil {
+			return err
+		}
+		defer remove()
+	}
+	ignoreSIGPIPE()
+
+	var conn net.Conn
+	if *flagListen != "" {
+		if *flagInput != "" || *flagInputString != "" || len(*flagOutput) > 0 {
+			return fmt.Errorf("can not use --listen together with --input, --input-string or --output")
+		}
+		var err error
+		if conn, err = acceptConnection(*flagListen); err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+
+	var pty *ptySession
+	if *flagPTY {
+		if *flagRawTTY || withDebugger || conn != nil {
+			return fmt.Errorf("can not use --pty together with --raw-tty, --listen or the debugger")
+		}
+		if *flagInput != "" || *flagInputString != "" || len(*flagOutput) > 0 {
+			return fmt.Errorf("can not use --pty together with --input, --input-string or --output")
+		}
+		var err error
+		if pty, err = startPTY(p); err != nil {
+			return err
+		}
+		defer pty.Close()
+	}
+
+	var driver *expectDriver
+	if *flagExpect != "" {
+		if *flagInput != "" || *flagInputString != "" || conn != nil || pty != nil {
+			return fmt.Errorf("can not use --expect together with --input, --input-string, --listen or --pty")
+		}
+		var err error
+		if driver, err = startExpect(*flagExpect, p); err != nil {
+			return err
+		}
+	}
+
+	in, err := programInput()
+	if err != nil {
+		return err
+	}
+	if conn != nil {
+		in = conn
+	}
+	if pty != nil {
+		in = pty.slave
+	}
+	if driver != nil {
+		in = driver.Input
+	}
+	if c, ok := in.(io.Closer); ok && in != io.Reader(os.Stdin) {
+		defer c.Close()
+	}
+	stdin := in
+	if in == io.Reader(os.Stdin) {
+		stdin = consoleInput(os.Stdin)
+		if *flagWatch && !withDebugger {
+			stdin = watchInput(stdin)
+		}
+	}
+	if *flagUnbufferedInput {
+		stdin = singleByteReader{stdin}
+	}
+	if prefix := inputPrefix(); len(prefix) > 0 {
+		stdin = io.MultiReader(bytes.NewReader(prefix), stdin)
+	}
+	stdin = filterInput(stdin)
+	if *flagInputRate > 0 {
+		stdin = newRateReader(stdin, int(*flagInputRate))
+	}
+	if *flagNonblockingInput || *flagInputTimeout > 0 {
+		r := newBackgroundReader(stdin)
+		r.nonblocking = *flagNonblockingInput
+		r.timeout, r.timeoutErr = *flagInputTimeout, inputTimeoutError()
+		stdin = r
+		p.NoInput = *flagNoInputValue
+	}
+	p.Stdin(stdin)
+
+	out, err := programOutput()
+	if err != nil {
+		return err
+	}
+	if conn != nil {
+		out = conn
+	}
+	if c, ok := out.(io.Closer); ok && out != io.Writer(os.Stdout) {
+		defer c.Close()
+	}
+	outputToStdout := out == io.Writer(os.Stdout) && pty == nil
+	outputToTerminal := out == io.Writer(os.Stdout) && isTerminal(os.Stdout)
+	if pty != nil {
+		out = pty.slave
+	}
+	if *flagRawTTY {
+		if withDebugger {
+			return fmt.Errorf("can not use raw terminal mode together with the debugger")
+		}
+		if in != io.Reader(os.Stdin) {
+			return fmt.Errorf("can not use raw terminal mode when reading input from elsewhere than standard input")
+		}
+		restore, err := makeRawTerminal()
+		if err != nil {
+			return err
+		}
+		defer restore()
+		p.OnInput(interruptOnCtrlC)
+		if outputToTerminal {
+			out = crlfWriter{out}
+		}
+	}
+	if *flagOutputRate > 0 {
+		out = newRateWriter(out, int(*flagOutputRate))
+	}
+
+	// Output is written out before returning, also after failing
+	buffered := newFlushWriter(out, outputToTerminal, withDebugger || *flagStepDelay > 0)
+	defer buffered.Flush()
+	if buffered.policy != "exit" {
+		p.OnInputWait(func(p *bf.Processor) {
+			buffered.Flush()
+		})
+	}
+	if outputToStdout {
+		screenOutput = buffered
+		defer func() {
+			screenOutput = os.Stdout
+		}()
+	}
+	out = buffered
+	if driver != nil {
+		out = io.MultiWriter(out, driver)
+	}
+
+	p.ByteOutput = *flagIO != "latin1" || *flagOutputEncoding != ""
+	out, flushOutput, err := encodeOutput(out)
+	if err != nil {
+		return err
+	}
+	// What the encoding holds back gets written out also after failing,
+	// ahead of the deferred flush of buffered
+	outputFlushed := false
+	defer func() {
+		if !outputFlushed {
+			flushOutput()
+		}
+	}()
+	if *flagMaxOutput > 0 {
+		out = &limitedWriter{
+			w:        out,
+			limit:    int64(*flagMaxOutput),
+			truncate: *flagMaxOutputPolicy == "truncate",
+		}
+	}
+	p.Stdout(out)
+
+	p.CountHits = *flagCoverage || *flagProfileListing
+	p.CountWrites = *flagHeatmap || *flagHeatmapPNG != ""
+
+	if *flagStepDelay > 0 {
+		delay := *flagStepDelay
+		p.OnStep(func(p *bf.Processor) {
+			fmt.Fprintf(os.Stderr, "%8d  %c  %s\n", p.InstructionPointer(), p.Instruction(), formatTapeWindow(p, 8))
+			time.Sleep(delay)
+		})
+	}
+
+	if *flagPrompt != "" && !*flagRawTTY && !*flagNonblockingInput && in == io.Reader(os.Stdin) && isTerminal(os.Stdin) {
+		prompt, status := *flagPrompt, diagnostics()
+		p.OnInputWait(func(p *bf.Processor) {
+			fmt.Fprint(status, prompt)
+		})
+	}
+
+	if *flagEchoInput {
+		p.OnInput(echoInput)
+	}
+
+	handleStatsRequests(p)
+
+	if *flagEvents != "" {
+		f, err := os.Create(*flagEvents)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		events := bufio.NewWriter(f)
+		defer events.Flush()
+		p.Subscribe(newEventLogger(events).Event)
+	}
+
+	if withDebugger {
+		p.OnStep(newDebugger(openTerminal(), os.Stderr, source).Step)
+	}
+
+	var recorder *gifRecorder
+	if *flagGIF != "" {
+		if *flagGIFInterval == 0 {
+			return fmt.Errorf("GIF frame interval must be at least 1")
+		}
+		recorder = newGIFRecorder(*flagGIFInterval)
+		p.OnStep(recorder.Step)
+	}
+
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt)
+	done := make(chan struct{})
+	defer func() {
+		signal.Stop(interrupts)
+		close(done)
+	}()
+	go func() {
+		select {
+		case <-interrupts:
+		case <-done:
+			return
+		}
+		p.Stop()
+		// The program may be blocked waiting for input, give up on a
+		// clean stop if interrupted a second time
+		select {
+		case <-interrupts:
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	// The status line would get in the way of output to the same terminal
+	stopProgress := func() {}
+	if !*flagNoProgress && !*flagQuiet && !withDebugger && *flagStepDelay == 0 &&
+		isTerminal(os.Stderr) && !outputToTerminal {
+		stopProgress = showProgress(os.Stderr, p)
+		defer stopProgress()
+	}
+
+	p.Load(source)
+	if *flagArgsTo == "tape" {
+		if err := writeArgsToTape(p, *flagArgs); err != nil {
+			return err
+		}
+	}
+	_, span := tracer.Start(traceContext, "execute")
+	err = p.Execute()
+	span.SetAttributes(executionAttributes(p)...)
+	endSpan(span, err)
+	stopProgress()
+	if err == nil {
+		err = p.ExpectEnd()
+	}
+	if err == nil {
+		err = p.Flush()
+	}
+	if err == nil {
+		outputFlushed = true
+		err = flushOutput()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if driver != nil {
+		// The script stops the program if it fails, which may be waiting
+		// for input and then read the end of it
+		if scriptErr := driver.Finish(); scriptErr != nil && (err == nil || errors.Is(err, bf.ErrInterrupted) || err == io.EOF) {
+			err = scriptErr
+		}
+	}
+	if isBrokenPipe(err) {
+		// Whatever reads the output is gone, like SIGPIPE would end the
+		// program
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if *flagCoverage {
+		if err := writeCoverageReport(os.Stderr, source, p.Hits()); err != nil {
+			return err
+		}
+	}
+
+	if *flagProfileListing {
+		if err := writeProfileListing(os.Stderr, source, p.Hits()); err != nil {
+			return err
+		}
+	}
+
+	if *flagHeatmap {
+		if err := writeHeatmap(os.Stderr, p.Writes(), colorEnabled(os.Stderr, *flagNoColor)); err != nil {
+			return err
+		}
+	}
+
+	if recorder != nil {
+		recorder.Capture(p)
+		if err := writeFile(*flagGIF, recorder.Encode); err != nil {
+			return err
+		}
+	}
+
+	if *flagHeatmapPNG != "" {
+		err := writeFile(*flagHeatmapPNG, func(w io.Writer) error {
+			return writeHeatmapPNG(w, p.Writes())
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exitCell returns the value of the data cell selected by --exit-cell.
+func exitCell(p *bf.Processor, which string) int {
+	if which == "first" {
+		return int(p.Data[0])
+	}
+	return int(p.Current())
+}
+
+// runOrExit runs the program in source and exits unless it halted normally.
+// With --exit-cell, it exits with the value of the selected data cell even
+// then.
+func runOrExit(source []byte, withDebugger bool) {
+	p := newProcessor()
+
+	err := run(p, source, withDebugger)
+	finishTracing()
+	switch {
+	case err == nil:
+		if *flagExitCell != "" {
+			os.Exit(exitCell(p, *flagExitCell))
+		}
+	case errors.Is(err, bf.ErrInterrupted):
+		fmt.Fprintf(diagnostics(), "\ninterrupted: %s\n", describeState(p, source))
+		os.Exit(130)
+	default:
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// screenOutput is where screen devices draw. While a program runs with its
+// output going to standard output, run points it at the buffered program
+// output, so that drawing and output show up in the order written.
+var screenOutput io.Writer = os.Stdout
+
+// screenDevice shows its data cells as a grid of characters on the
+// terminal, one row after another. The cursor is left below the grid so
+// that other output does not overwrite it.
+type screenDevice struct {
+	width, height int
+	cleared       bool
+
+	// What is currently shown on the terminal, to skip redrawing cells
+	// whose character did not change
+	shown []rune
+}
+
+func (d *screenDevice) ReadCell(p *bf.Processor, offset int) byte {
+	return p.Data[p.DataPointer]
+}
+
+func (d *screenDevice) WriteCell(p *bf.Processor, offset int, value byte) {
+	if !d.cleared {
+		d.cleared = true
+		d.shown = make([]rune, d.width*d.height)
+		fmt.Fprint(screenOutput, "\x1b[2J")
+	}
+
+	char := rune(value)
+	if value < ' ' || value == 0x7f {
+		char = ' '
+	}
+	if d.shown[offset] == char {
+		return
+	}
+	d.shown[offset] = char
+	fmt.Fprintf(screenOutput, "\x1b[%d;%dH%c\x1b[%d;1H", 1+offset/d.width, 1+offset%d.width, char, d.height+1)
+
+	// Drawing shows right away, unless all output is held back until exit
+	if f, ok := screenOutput.(*flushWriter); ok && f.policy != "exit" {
+		f.Flush()
+	}
+}
+
+func init() {
+	registerDevice("screen", func() (bf.Device, int, error) {
+		var width, height int
+		if _, err := fmt.Sscanf(*flagScreenSize, "%dx%d", &width, &height); err != nil || width < 1 || height < 1 {
+			return nil, 0, fmt.Errorf("invalid screen size %q, expected WIDTHxHEIGHT", *flagScreenSize)
+		}
+		return &screenDevice{width: width, height: height}, width * height, nil
+	})
+}
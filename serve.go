@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serveRequest is a program submitted to the server, along with its input.
+type serveRequest struct {
+	Program string        `json:"program"`
+	Input   string        `json:"input"`
+	Limits  sandboxLimits `json:"limits"`
+}
+
+// serveResult is what the server responds with once a submitted program
+// halted.
+type serveResult struct {
+	Output string        `json:"output"`
+	Steps  uint64        `json:"steps"`
+	Time   time.Duration `json:"time_ns"`
+	Error  string        `json:"error,omitempty"`
+	// Set if the program got stopped for exceeding a limit
+	LimitExceeded *LimitError `json:"limit_exceeded,omitempty"`
+}
+
+// sandboxLimits caps the execution of a submitted program, 0 meaning no
+// limit.
+type sandboxLimits struct {
+	Steps uint64 `json:"steps"`
+	// Data cells
+	Memory uint64 `json:"memory"`
+	// Bytes of output
+	Output  uint64        `json:"output"`
+	Timeout time.Duration `json:"timeout_ns"`
+}
+
+// serverLimits returns the limits given to the serve command, with timeout
+// as the one applying to how the program is run.
+func serverLimits(timeout time.Duration) sandboxLimits {
+	return sandboxLimits{
+		Steps:   *flagServeMaxSteps,
+		Memory:  uint64(*flagServeMaxMemory),
+		Output:  uint64(*flagMaxOutput),
+		Timeout: timeout,
+	}
+}
+
+// lower returns the limits l lowered to those requested, leaving out any
+// above l.
+func (l sandboxLimits) lower(requested sandboxLimits) sandboxLimits {
+	min := func(limit, requested uint64) uint64 {
+		if requested > 0 && (limit == 0 || requested < limit) {
+			return requested
+		}
+		return limit
+	}
+	return sandboxLimits{
+		Steps:   min(l.Steps, requested.Steps),
+		Memory:  min(l.Memory, requested.Memory),
+		Output:  min(l.Output, requested.Output),
+		Timeout: time.Duration(min(uint64(l.Timeout), uint64(requested.Timeout))),
+	}
+}
+
+// executionLimits stops programs once they exceed their limits, remembering
+// which one.
+type executionLimits struct {
+	// Data cells
+	memory uint64
+
+	mu sync.Mutex
+	// A *LimitError unless stopped for ctx
+	err  error
+	done chan struct{}
+}
+
+func (l *executionLimits) exceed(p *bf.Processor, err error) {
+	l.mu.Lock()
+	if l.err == nil {
+		l.err = err
+		close(l.done)
+	}
+	l.mu.Unlock()
+	p.Stop()
+}
+
+// Done returns a channel closed once the program exceeded a limit.
+func (l *executionLimits) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns the limit the program got stopped for, if any.
+func (l *executionLimits) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Result returns why execution failed with err: the limit the program got
+// stopped for or exceeded by its data cells, or err otherwise.
+func (l *executionLimits) Result(err error) error {
+	if stopped := l.Err(); err != nil && stopped != nil {
+		return stopped
+	}
+	if errors.Is(err, bf.ErrDataLimit) {
+		return &LimitError{Limit: "memory", Max: l.memory}
+	}
+	return err
+}
+
+// limitExecution makes p get stopped once it exceeds the steps, memory or
+// timeout of limits, or once ctx is done.
+func limitExecution(ctx context.Context, p *bf.Processor, limits sandboxLimits) *executionLimits {
+	l := &executionLimits{done: make(chan struct{}), memory: limits.Memory}
+	// The data cells, including other tapes and threads, do not grow
+	// beyond, while those growing other ways get noticed after the fact
+	p.MaxData = int(limits.Memory)
+	// Cells allocated up front but not used yet do not count
+	for limits.Memory > 0 && uint64(len(p.Data)) > limits.Memory && p.DataPointer < len(p.Data)-1 && p.Data[len(p.Data)-1] == 0 {
+		p.Data = p.Data[:len(p.Data)-1]
+	}
+	// Stopping the program from the hook keeps the step from executing
+	p.OnStep(func(p *bf.Processor) {
+		switch {
+		case limits.Steps > 0 && p.Steps() > limits.Steps:
+			l.exceed(p, &LimitError{Limit: "steps", Max: limits.Steps})
+		case limits.Memory > 0 && uint64(p.DataCells()) > limits.Memory:
+			l.exceed(p, &LimitError{Limit: "memory", Max: limits.Memory})
+		}
+	})
+
+	go func() {
+		var expired <-chan time.Time
+		if limits.Timeout > 0 {
+			timer := time.NewTimer(limits.Timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case <-expired:
+			l.exceed(p, &LimitError{Limit: "time", Max: uint64(limits.Timeout)})
+		case <-ctx.Done():
+			l.exceed(p, ctx.Err())
+		}
+	}()
+	return l
+}
+
+// executeSubmitted runs a program submitted to the server until it halts,
+// fails or exceeds the limits, or until ctx is done.
+func executeSubmitted(ctx context.Context, req serveRequest, limits sandboxLimits) serveResult {
+	var output bytes.Buffer
+	result := runSubmitted(ctx, req.Program, strings.NewReader(req.Input), &output, limits)
+	result.Output = output.String()
+	return result
+}
+
+// runSubmitted runs program like executeSubmitted, with input read from in
+// and output written to w as it is produced. Reading from an io.PipeReader
+// given as in fails once the program exceeds the limits, as the program
+// might be waiting for input. The processor is passed to configure before
+// execution starts.
+func runSubmitted(ctx context.Context, program string, in io.Reader, w io.Writer, limits sandboxLimits, configure ...func(p *bf.Processor)) serveResult {
+	_, span := tracer.Start(ctx, "load", trace.WithAttributes(attribute.Int("gobfy.source_bytes", len(program))))
+	source := translateSource([]byte(program))
+	if *flagStrict {
+		if err := checkStrict(source); err != nil {
+			endSpan(span, err)
+			return serveResult{Error: err.Error()}
+		}
+	}
+	span.End()
+
+	out, flushOutput, err := encodeOutput(w)
+	if err != nil {
+		return serveResult{Error: err.Error()}
+	}
+	if limits.Output > 0 {
+		out = &limitedWriter{
+			w:        out,
+			limit:    int64(limits.Output),
+			truncate: *flagMaxOutputPolicy == "truncate",
+		}
+	}
+
+	p := newProcessor()
+	p.ByteOutput = *flagIO != "latin1" || *flagOutputEncoding != ""
+	p.Stdin(filterInput(in))
+	p.Stdout(out)
+	p.Load(source)
+	for _, f := range configure {
+		f(p)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := limitExecution(ctx, p, limits)
+	if pipe, ok := in.(*io.PipeReader); ok {
+		// Not ctx, which also gets done when the program gets stopped for it
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-stop.Done():
+				pipe.CloseWithError(stop.Err())
+			case <-done:
+			}
+		}()
+	}
+
+	_, span = tracer.Start(ctx, "execute")
+	start := time.Now()
+	err = p.Execute()
+	elapsed := time.Since(start)
+	span.SetAttributes(executionAttributes(p)...)
+	endSpan(span, err)
+	// Execution fails in whichever way when stopped while waiting for input
+	stopped := stop.Err()
+	err = stop.Result(err)
+	if err == nil {
+		err = p.ExpectEnd()
+	}
+	if err == nil {
+		err = p.Flush()
+	}
+	if err == nil {
+		err = flushOutput()
+	}
+
+	result := serveResult{Steps: p.Steps(), Time: elapsed}
+	outcome, limit := "ok", ""
+	switch {
+	case err == nil:
+	case errors.As(err, &result.LimitExceeded):
+		outcome, limit = "limit", result.LimitExceeded.Limit
+	case err == stopped:
+		outcome = "canceled"
+	default:
+		outcome = "error"
+	}
+	metrics.record(outcome, limit, p.Steps(), elapsed, len(p.Data))
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// readSubmission reads a program submitted in the body of r, either as JSON
+// object with program, input and limits, or as the program's source with the
+// input and limits given by query parameters.
+func readSubmission(w http.ResponseWriter, r *http.Request) (serveRequest, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(*flagServeMaxRequestSize)))
+	if err != nil {
+		return serveRequest{}, err
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req serveRequest
+		err := json.Unmarshal(body, &req)
+		return req, err
+	}
+	limits, err := parseLimits(r.URL.Query())
+	return serveRequest{Program: string(body), Input: r.URL.Query().Get("input"), Limits: limits}, err
+}
+
+// parseLimits returns the limits requested by the query parameters
+// max_steps, max_memory, max_output and timeout.
+func parseLimits(query url.Values) (sandboxLimits, error) {
+	var limits sandboxLimits
+	for name, limit := range map[string]*uint64{
+		"max_steps":  &limits.Steps,
+		"max_memory": &limits.Memory,
+		"max_output": &limits.Output,
+	} {
+		if value := query.Get(name); value != "" {
+			var err error
+			if *limit, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return limits, fmt.Errorf("invalid %s %q", name, value)
+			}
+		}
+	}
+	if value := query.Get("timeout"); value != "" {
+		var err error
+		if limits.Timeout, err = time.ParseDuration(value); err != nil || limits.Timeout < 0 {
+			return limits, fmt.Errorf("invalid timeout %q", value)
+		}
+	}
+	return limits, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// handleRun executes a submitted program and responds with its result,
+// with status 422 if the program failed.
+func handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("programs need to be submitted by POST"))
+		return
+	}
+	req, err := readSubmission(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result := executeSubmitted(r.Context(), req, serverLimits(*flagServeTimeout).lower(req.Limits))
+	status := http.StatusOK
+	if result.Error != "" {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, result)
+}
+
+// serveMux returns the handler for the server's endpoints.
+func serveMux(jobs *jobStore) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", handleRun)
+	mux.HandleFunc("/jobs", jobs.handleSubmit)
+	mux.HandleFunc("/jobs/", jobs.handleJob)
+	mux.HandleFunc("/stream", handleStream)
+	mux.Handle("/metrics", metrics)
+	return mux
+}
+
+// serve runs an HTTP server on addr executing the programs submitted to it,
+// along with the gRPC service if enabled by --grpc and the SSH server if
+// enabled by --ssh. Sockets passed by systemd named http, grpc and ssh are
+// used instead of listening on the addresses, and enable the services.
+func serve(addr string) error {
+	// Fail right away on flags that would fail each program
+	newProcessor()
+	if _, _, err := encodeOutput(&bytes.Buffer{}); err != nil {
+		return err
+	}
+	if err := checkIsolation(); err != nil {
+		return err
+	}
+	jobs, err := newJobStore(*flagServeJobTTL, *flagServeWorkers, *flagServeJobStore)
+	if err != nil {
+		return err
+	}
+	listeners := &serverListeners{}
+	if listeners.activated, err = activatedListeners(); err != nil {
+		return err
+	}
+	var sshd *sshServer
+	if *flagServeSSH != "" || listeners.Activated("ssh") {
+		if sshd, err = newSSHServer(); err != nil {
+			return err
+		}
+	}
+
+	l, err := listeners.Listen("http", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(diagnostics(), "listening on %s\n", l.Addr())
+	var grpcListener, sshListener net.Listener
+	if *flagServeGRPC != "" || listeners.Activated("grpc") {
+		if grpcListener, err = listeners.Listen("grpc", *flagServeGRPC); err != nil {
+			return err
+		}
+		fmt.Fprintf(diagnostics(), "gRPC listening on %s\n", grpcListener.Addr())
+	}
+	if sshd != nil {
+		if sshListener, err = listeners.Listen("ssh", *flagServeSSH); err != nil {
+			return err
+		}
+		fmt.Fprintf(diagnostics(), "serving SSH on %s\n", sshListener.Addr())
+	}
+	if err := listeners.Unused(); err != nil {
+		return err
+	}
+
+	// Only once listening, which may not be allowed afterwards
+	if err := isolate(); err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:  traceRequests(serveMux(jobs)),
+		ErrorLog: log.New(diagnostics(), "", log.LstdFlags),
+	}
+	errs := make(chan error, 3)
+	if grpcListener != nil {
+		go func() {
+			errs <- serveGRPC(grpcListener)
+		}()
+	}
+	if sshListener != nil {
+		go func() {
+			errs <- sshd.Serve(sshListener)
+		}()
+	}
+	go func() {
+		errs <- server.Serve(l)
+	}()
+	return <-errs
+}
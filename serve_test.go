@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		query  string
+		limits sandboxLimits
+		err    bool
+	}{
+		{"", sandboxLimits{}, false},
+		{"max_steps=100", sandboxLimits{Steps: 100}, false},
+		{"max_memory=30000&max_output=10", sandboxLimits{Memory: 30000, Output: 10}, false},
+		{"timeout=1.5s", sandboxLimits{Timeout: 1500 * time.Millisecond}, false},
+		{"max_steps=100&timeout=20ms&input=abc", sandboxLimits{Steps: 100, Timeout: 20 * time.Millisecond}, false},
+		{"max_steps=-1", sandboxLimits{}, true},
+		{"max_memory=lots", sandboxLimits{}, true},
+		{"max_output=1e3", sandboxLimits{}, true},
+		{"timeout=10", sandboxLimits{}, true},
+		{"timeout=-1s", sandboxLimits{}, true},
+	}
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		limits, err := parseLimits(query)
+		if (err != nil) != test.err {
+			t.Errorf("%q: got error %v, expected error: %v", test.query, err, test.err)
+			continue
+		}
+		if err == nil && limits != test.limits {
+			t.Errorf("%q: got %+v, expected %+v", test.query, limits, test.limits)
+		}
+	}
+}
+
+func TestSandboxLimitsLower(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    sandboxLimits
+		requested sandboxLimits
+		lowered   sandboxLimits
+	}{
+		{
+			name:      "none requested",
+			limits:    sandboxLimits{Steps: 100, Memory: 200, Output: 300, Timeout: time.Second},
+			requested: sandboxLimits{},
+			lowered:   sandboxLimits{Steps: 100, Memory: 200, Output: 300, Timeout: time.Second},
+		},
+		{
+			name:      "lower requested",
+			limits:    sandboxLimits{Steps: 100, Memory: 200, Output: 300, Timeout: time.Second},
+			requested: sandboxLimits{Steps: 10, Memory: 20, Output: 30, Timeout: time.Millisecond},
+			lowered:   sandboxLimits{Steps: 10, Memory: 20, Output: 30, Timeout: time.Millisecond},
+		},
+		{
+			name:      "higher requested",
+			limits:    sandboxLimits{Steps: 100, Memory: 200, Output: 300, Timeout: time.Second},
+			requested: sandboxLimits{Steps: 1000, Memory: 2000, Output: 3000, Timeout: time.Minute},
+			lowered:   sandboxLimits{Steps: 100, Memory: 200, Output: 300, Timeout: time.Second},
+		},
+		{
+			name:      "no limits",
+			limits:    sandboxLimits{},
+			requested: sandboxLimits{Steps: 1000, Timeout: time.Minute},
+			lowered:   sandboxLimits{Steps: 1000, Timeout: time.Minute},
+		},
+		{
+			name:      "mixed",
+			limits:    sandboxLimits{Steps: 100, Output: 300},
+			requested: sandboxLimits{Steps: 1000, Memory: 20, Output: 30},
+			lowered:   sandboxLimits{Steps: 100, Memory: 20, Output: 30},
+		},
+	}
+	for _, test := range tests {
+		if lowered := test.limits.lower(test.requested); lowered != test.lowered {
+			t.Errorf("%s: got %+v, expected %+v", test.name, lowered, test.lowered)
+		}
+	}
+}
+
+func TestLimitExecution(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	defer func(tapes int, tokens string) {
+		*flagTapes, *flagTapeTokens = tapes, tokens
+	}(*flagTapes, *flagTapeTokens)
+	*flagTapes, *flagTapeTokens = 3, "{}"
+
+	tests := []struct {
+		name    string
+		program string
+		limits  sandboxLimits
+		ctx     context.Context
+		ext     *bf.Extension
+		// The limit exceeded, if any
+		limit string
+		err   error
+	}{
+		{name: "no limits", program: "+++[>++<-]"},
+		{name: "within limits", program: "+++[>++<-]", limits: sandboxLimits{Steps: 100, Memory: 2, Timeout: time.Minute}},
+		{name: "steps", program: "+[]", limits: sandboxLimits{Steps: 1000}, limit: "steps"},
+		{name: "memory", program: "+[>+]", limits: sandboxLimits{Memory: 100}, limit: "memory"},
+		{name: "memory right away", program: ">>>>>>>>>>+", limits: sandboxLimits{Memory: 10}, limit: "memory"},
+		{name: "memory at the limit", program: ">>>>>>>>>+", limits: sandboxLimits{Memory: 10}},
+		{name: "memory of tapes", program: "+[}>+]", limits: sandboxLimits{Memory: 100}, ext: multitape, limit: "memory"},
+		{name: "memory of rows", program: "+[v+]", limits: sandboxLimits{Memory: 100}, ext: grid, limit: "memory"},
+		{name: "memory of threads", program: "+[Y]", limits: sandboxLimits{Memory: 100}, ext: brainfork, limit: "memory"},
+		{name: "time", program: "+[]", limits: sandboxLimits{Timeout: 10 * time.Millisecond}, limit: "time"},
+		{name: "canceled", program: "+[]", ctx: canceled, err: context.Canceled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := test.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			p := bf.NewProcessor()
+			if test.ext != nil {
+				if err := p.Extend(test.ext); err != nil {
+					t.Fatal(err)
+				}
+			}
+			p.Load([]byte(test.program))
+			stop := limitExecution(ctx, p, test.limits)
+			err := stop.Result(p.Execute())
+
+			var limit *LimitError
+			switch {
+			case test.limit != "":
+				if !errors.As(err, &limit) || limit.Limit != test.limit {
+					t.Fatalf("got error %v, expected to exceed the %s limit", err, test.limit)
+				}
+			case err != test.err:
+				t.Fatalf("got error %v, expected %v", err, test.err)
+			}
+			if test.limits.Memory > 0 && uint64(p.DataCells()) > test.limits.Memory {
+				t.Errorf("program got %d data cells, above the limit of %d", p.DataCells(), test.limits.Memory)
+			}
+			if test.limits.Steps > 0 && p.Steps() > test.limits.Steps {
+				t.Errorf("program executed %d steps, above the limit of %d", p.Steps(), test.limits.Steps)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// sessionState is the state of a program run by a session, paused before
+// an instruction or halted.
+type sessionState struct {
+	InstructionPointer int
+	Instruction        byte
+	DataPointer        int
+	Cell               byte
+	// Instructions executed so far
+	Steps uint64
+	// Output since the previous state, unless passed on as it is produced
+	Output []byte
+	// Set once the program halted
+	Result *serveResult
+}
+
+// session executes a program step by step for embedders, pausing it in a
+// step hook like the debugger does.
+type session struct {
+	p      *bf.Processor
+	output bytes.Buffer
+	// Steps to execute before pausing again, 0 for running to the end
+	resume chan uint64
+	paused chan sessionState
+	done   chan serveResult
+
+	remaining uint64
+	toEnd     bool
+	stopped   bool
+	result    *sessionState
+}
+
+// startSession starts program paused before its first instruction, with
+// its output written to w, or kept for the states if nil.
+func startSession(program string, input []byte, w io.Writer) *session {
+	s := &session{
+		resume: make(chan uint64),
+		paused: make(chan sessionState),
+		done:   make(chan serveResult),
+	}
+	if w == nil {
+		w = &s.output
+	}
+	go func() {
+		s.resumed(<-s.resume)
+		s.done <- runSubmitted(context.Background(), program, bytes.NewReader(input), w, sandboxLimits{},
+			func(p *bf.Processor) {
+				s.p = p
+				p.OnStep(s.step)
+				if s.stopped {
+					p.Stop()
+				}
+			})
+	}()
+	return s
+}
+
+func (s *session) resumed(n uint64) {
+	s.remaining, s.toEnd = n, n == 0
+}
+
+// state returns the state of p, along with the output since the previous
+// state.
+func (s *session) state(p *bf.Processor) sessionState {
+	state := sessionState{
+		InstructionPointer: p.InstructionPointer(),
+		Instruction:        p.Instruction(),
+		DataPointer:        p.DataPointer,
+		Cell:               p.Current(),
+		// The instruction about to be executed is counted already
+		Steps:  p.Steps() - 1,
+		Output: append([]byte{}, s.output.Bytes()...),
+	}
+	s.output.Reset()
+	return state
+}
+
+func (s *session) step(p *bf.Processor) {
+	if s.toEnd {
+		return
+	}
+	if s.remaining > 0 {
+		s.remaining--
+		return
+	}
+	s.paused <- s.state(p)
+	s.resumed(<-s.resume)
+	// The instruction paused at is the first of those to execute
+	if s.remaining > 0 {
+		s.remaining--
+	}
+}
+
+// Step resumes the program for n steps, or until its end if 0, and returns
+// its state then.
+func (s *session) Step(n uint64) sessionState {
+	if s.result == nil {
+		s.resume <- n
+		select {
+		case state := <-s.paused:
+			return state
+		case result := <-s.done:
+			s.result = &sessionState{Steps: result.Steps, Output: s.output.Bytes(), Result: &result}
+		}
+	}
+	return *s.result
+}
+
+// Stop stops the program and returns its state once halted.
+func (s *session) Stop() sessionState {
+	if s.p != nil {
+		s.p.Stop()
+	}
+	s.stopped = true
+	return s.Step(0)
+}
@@ -0,0 +1,18 @@
+package main
+
+import "bytes"
+
+// splitShebang splits off a leading "#!" line so that source files can be
+// made executable scripts. The line break ending the shebang line is kept
+// as part of the rest so that line numbers stay the same.
+func splitShebang(source []byte) (shebang, rest []byte) {
+	if !bytes.HasPrefix(source, []byte("#!")) {
+		return nil, source
+	}
+
+	end := bytes.IndexByte(source, '\n')
+	if end < 0 {
+		return source, nil
+	}
+	return source[:end], source[end:]
+}
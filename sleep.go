@@ -0,0 +1,26 @@
+package main
+
+import (
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// The sleep extension adds an instruction pausing execution, so programs
+// can pace themselves without busy loops.
+var sleep = &bf.Extension{
+	Name:        "sleep",
+	Description: "Sleep: % pauses execution for as many milliseconds as the value of the current cell.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		return map[byte]func(p *bf.Processor) error{
+			'%': func(p *bf.Processor) error {
+				time.Sleep(time.Duration(p.Current()) * time.Millisecond)
+				return nil
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(sleep)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const socketDialTimeout = 10 * time.Second
+
+// The socket extension lets programs redirect their input and output
+// instructions to a TCP connection. Only hosts and ports given by
+// --allow-connect can be connected to.
+var socket = &bf.Extension{
+	Name:        "socket",
+	Description: "TCP sockets: & connects to the NUL-terminated HOST:PORT address starting at the cell right of the current one, and sets the current cell to 0 on success or 1 on failure. Input and output instructions then use the connection until ~ closes it.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		allowed := *flagAllowConnect
+
+		var conn net.Conn
+		var stdin io.Reader
+		var stdout io.Writer
+
+		disconnect := func(p *bf.Processor) error {
+			if conn == nil {
+				return nil
+			}
+			p.Stdin(stdin)
+			p.Stdout(stdout)
+			err := conn.Close()
+			conn = nil
+			return err
+		}
+
+		connect := func(p *bf.Processor) error {
+			if err := disconnect(p); err != nil {
+				return err
+			}
+
+			address := readCString(p, p.DataPointer+1)
+			var err error
+			if !isAddressAllowed(address, allowed) {
+				err = fmt.Errorf("%s is not among the addresses given by --allow-connect", address)
+			} else {
+				conn, err = net.DialTimeout("tcp", address, socketDialTimeout)
+			}
+			if err != nil {
+				if p.DebugLevel >= bf.DebugLevelLoops {
+					log.Printf("can not connect: %s", err)
+				}
+				p.Data[p.DataPointer] = 1
+				p.CellWritten()
+				return nil
+			}
+
+			stdin, stdout = p.Streams()
+			p.Stdin(conn)
+			p.Stdout(conn)
+			p.Data[p.DataPointer] = 0
+			p.CellWritten()
+			return nil
+		}
+
+		return map[byte]func(p *bf.Processor) error{
+			'&': connect,
+			'~': disconnect,
+		}, nil
+	},
+}
+
+// isAddressAllowed reports whether address is one of allowed, which may
+// also give just a host to allow any port on it.
+func isAddressAllowed(address string, allowed []string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == address || a == host {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	bf.RegisterExtension(socket)
+}
@@ -0,0 +1,28 @@
+package main
+
+// Spoon encodes Brainfuck's instructions as a prefix code of binary digits,
+// plus instructions for dumping the state and exiting.
+var spoon = &Dialect{
+	Name:        "spoon",
+	Description: "Spoon, with instructions encoded as binary digits",
+	Tokens: map[string]string{
+		"1":        "+",
+		"000":      "-",
+		"010":      ">",
+		"011":      "<",
+		"0011":     "]",
+		"00100":    "[",
+		"001010":   ".",
+		"0010110":  ",",
+		"00101110": "#",
+		"00101111": "@",
+	},
+	Alphabet:   "01",
+	Extensions: []string{"dump", "extended1"},
+}
+
+func init() {
+	if err := registerDialect(spoon); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshPrograms are the programs offered over SSH by name, the base name of
+// their source without extension.
+type sshPrograms struct {
+	sources map[string]string
+	// Run for sessions not asking for a program by name
+	first string
+}
+
+// loadSSHPrograms loads the programs at paths, leaving their translation to
+// runSubmitted like for submitted programs.
+func loadSSHPrograms(paths []string) (*sshPrograms, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("--ssh needs at least one program given by --ssh-program")
+	}
+	programs := &sshPrograms{sources: map[string]string{}}
+	for _, path := range paths {
+		input, err := loadRawSource(path)
+		if err != nil {
+			return nil, err
+		}
+		_, source := splitShebang(input)
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if _, ok := programs.sources[name]; ok {
+			return nil, fmt.Errorf("there is more than one program named %s", name)
+		}
+		programs.sources[name] = string(source)
+		if programs.first == "" {
+			programs.first = name
+		}
+	}
+	return programs, nil
+}
+
+func (s *sshPrograms) names() []string {
+	names := []string{}
+	for name := range s.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sshServerConfig returns the configuration for the SSH server, with the
+// host key read from --ssh-host-key or generated for this run, and clients
+// allowed by --ssh-authorized-keys or all of them.
+func sshServerConfig() (*ssh.ServerConfig, error) {
+	config := &ssh.ServerConfig{}
+
+	if *flagServeSSHAuthorizedKeys == "" {
+		config.NoClientAuth = true
+	} else {
+		data, err := ioutil.ReadFile(*flagServeSSHAuthorizedKeys)
+		if err != nil {
+			return nil, err
+		}
+		authorized := map[string]bool{}
+		for len(bytes.TrimSpace(data)) > 0 {
+			key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", *flagServeSSHAuthorizedKeys, err)
+			}
+			authorized[string(key.Marshal())] = true
+			data = rest
+		}
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !authorized[string(key.Marshal())] {
+				return nil, fmt.Errorf("unknown public key for %s", conn.User())
+			}
+			return nil, nil
+		}
+	}
+
+	var signer ssh.Signer
+	if *flagServeSSHHostKey != "" {
+		data, err := ioutil.ReadFile(*flagServeSSHHostKey)
+		if err != nil {
+			return nil, err
+		}
+		if signer, err = ssh.ParsePrivateKey(data); err != nil {
+			return nil, fmt.Errorf("%s: %s", *flagServeSSHHostKey, err)
+		}
+	} else {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if signer, err = ssh.NewSignerFromKey(key); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(diagnostics(), "generated SSH host key %s\n", ssh.FingerprintSHA256(signer.PublicKey()))
+	}
+	config.AddHostKey(signer)
+	return config, nil
+}
+
+// sshServer runs the programs given by --ssh-program for clients connecting
+// by SSH, one for each session.
+type sshServer struct {
+	config   *ssh.ServerConfig
+	programs *sshPrograms
+}
+
+func newSSHServer() (*sshServer, error) {
+	programs, err := loadSSHPrograms(*flagServeSSHPrograms)
+	if err != nil {
+		return nil, err
+	}
+	config, err := sshServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &sshServer{config: config, programs: programs}, nil
+}
+
+// Serve accepts SSH connections on l until it fails.
+func (s *sshServer) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go handleSSHConnection(conn, s.config, s.programs)
+	}
+}
+
+func handleSSHConnection(conn net.Conn, config *ssh.ServerConfig, programs *sshPrograms) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		fmt.Fprintf(diagnostics(), "SSH connection from %s: %s\n", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	// Programs get stopped once the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go handleSSHSession(ctx, channel, requests, programs)
+	}
+}
+
+// handleSSHSession runs a program for a session once the client asks for a
+// shell, which runs the first program, or to execute a command, which names
+// the program.
+func handleSSHSession(ctx context.Context, channel ssh.Channel, requests <-chan *ssh.Request, programs *sshPrograms) {
+	defer channel.Close()
+	terminal := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			terminal = true
+			req.Reply(true, nil)
+		case "env", "window-change":
+			req.Reply(true, nil)
+		case "shell", "exec":
+			name := programs.first
+			if req.Type == "exec" {
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				name = strings.TrimSpace(payload.Command)
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			status := 127
+			if program, ok := programs.sources[name]; ok {
+				status = runSSHProgram(ctx, channel, program, terminal)
+			} else {
+				fmt.Fprintf(channel.Stderr(), "unknown program %s, available are: %s\n", name, strings.Join(programs.names(), ", "))
+			}
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// runSSHProgram runs program with its input read from channel and its output
+// written to it, and returns the exit status for the client. With a
+// terminal, the client sends keys as typed, which get echoed with carriage
+// returns becoming line feeds, and Ctrl+C stops the program while Ctrl+D
+// ends its input.
+func runSSHProgram(ctx context.Context, channel ssh.Channel, program string, terminal bool) int {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	interrupted := make(chan struct{})
+	inputWriter, input := newInputQueue(int(*flagServeMaxRequestSize))
+	var out io.Writer = channel
+	if terminal {
+		out = crlfWriter{channel}
+	}
+	// Input gets queued up, so that Ctrl+C and the client going away get
+	// noticed even while the program does not read
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := channel.Read(buf)
+			keys := buf[:n]
+			if terminal {
+				keys = []byte{}
+				for _, b := range buf[:n] {
+					switch b {
+					case 0x03:
+						close(interrupted)
+						cancel()
+						return
+					case 0x04:
+						inputWriter.Close()
+						continue
+					case '\r':
+						b = '\n'
+					}
+					keys = append(keys, b)
+				}
+				out.Write(keys)
+			}
+			if _, writeErr := inputWriter.Write(keys); writeErr == errInputQueueFull {
+				cancel()
+				return
+			}
+			if err != nil {
+				inputWriter.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	result := runSubmitted(ctx, program, input, out, serverLimits(*flagServeSessionTimeout))
+	input.Close()
+	if result.Error == "" {
+		return 0
+	}
+	var errOut io.Writer = channel.Stderr()
+	if terminal {
+		errOut = crlfWriter{errOut}
+	}
+	select {
+	case <-interrupted:
+		fmt.Fprint(errOut, "^C\n")
+		return 130
+	default:
+	}
+	fmt.Fprintf(errOut, "\n%s\n", result.Error)
+	return 1
+}
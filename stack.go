@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// The stack extension adds an auxiliary stack for the values of data cells,
+// holding up to --stack-depth values.
+var stack = &bf.Extension{
+	Name:        "stack",
+	Description: "Stack: ( pushes the value of the current cell onto the stack, ) pops the topmost value into the current cell.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		depth := *flagStackDepth
+		if depth < 1 {
+			return nil, fmt.Errorf("stack depth must be at least 1")
+		}
+
+		values := []byte{}
+		return map[byte]func(p *bf.Processor) error{
+			'(': func(p *bf.Processor) error {
+				if len(values) >= depth {
+					return fmt.Errorf("can not push onto stack, already holding the maximum of %d values (see --stack-depth)", depth)
+				}
+				values = append(values, p.Current())
+				return nil
+			},
+			')': func(p *bf.Processor) error {
+				if len(values) == 0 {
+					return errors.New("can not pop from stack, already empty")
+				}
+				p.Data[p.DataPointer] = values[len(values)-1]
+				p.CellWritten()
+				values = values[:len(values)-1]
+				return nil
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(stack)
+}
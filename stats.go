@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+func writeStats(w io.Writer, p *bf.Processor, elapsed time.Duration) {
+	rate := float64(p.Steps()) / elapsed.Seconds()
+	fmt.Fprintf(w, "stats: %d steps in %s (%.0f steps/s), data pointer %d, %d data cells reserved\n",
+		p.Steps(), elapsed.Round(time.Millisecond), rate, p.DataPointer, len(p.Data))
+	if stack := p.CallStack(); len(stack) > 0 {
+		fmt.Fprintln(w, bf.FormatCallStack(stack))
+	}
+}
+
+// handleStatsRequests prints statistics to standard error whenever they are
+// requested by signal, without interrupting execution. The statistics are
+// written from the goroutine executing the program to avoid racing it.
+func handleStatsRequests(p *bf.Processor) {
+	requests := make(chan os.Signal, 1)
+	notifyStatsRequest(requests)
+
+	var requested int32
+	go func() {
+		for range requests {
+			atomic.StoreInt32(&requested, 1)
+		}
+	}()
+
+	start := time.Now()
+	p.OnStep(func(p *bf.Processor) {
+		if atomic.LoadInt32(&requested) != 0 {
+			atomic.StoreInt32(&requested, 0)
+			writeStats(os.Stderr, p, time.Since(start))
+		}
+	})
+}
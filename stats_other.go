@@ -0,0 +1,9 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package main
+
+import "os"
+
+// There is no SIGUSR1 on this platform, statistics can't be requested.
+func notifyStatsRequest(c chan<- os.Signal) {}
@@ -0,0 +1,14 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyStatsRequest(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
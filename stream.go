@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// wsOutput sends each write as binary WebSocket message.
+type wsOutput struct {
+	conn *wsConn
+}
+
+func (o wsOutput) Write(b []byte) (int, error) {
+	if err := o.conn.WriteMessage(wsBinary, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// handleStream runs a program interactively over a WebSocket connection.
+// The first message the client sends holds the program, the following ones
+// its input, with an empty message ending the input. The program's output is
+// sent as binary messages as it is produced. Once the program halted, a text
+// message with its result like from /run without the output follows, and
+// the connection gets closed. Limits may be lowered by query parameters like
+// for /run.
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	limits, err := parseLimits(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	conn, err := upgradeWebSocket(w, r, int64(*flagServeMaxRequestSize), *flagServeAllowOrigin)
+	if err == errWebSocketOrigin {
+		writeJSONError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, program, err := conn.ReadMessage()
+	if err != nil {
+		conn.Close(wsCloseNormal, "")
+		return
+	}
+
+	// The program gets stopped once the client goes away
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	// Input gets queued up, so that close frames and pings get handled
+	// and the client going away gets noticed while the program does not read
+	inputWriter, input := newInputQueue(int(*flagServeMaxRequestSize))
+	go func() {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				inputWriter.CloseWithError(err)
+				cancel()
+				return
+			}
+			if len(message) == 0 {
+				inputWriter.Close()
+				continue
+			}
+			if _, err := inputWriter.Write(message); err == errInputQueueFull {
+				conn.Close(wsCloseTooBig, err.Error())
+				cancel()
+				return
+			}
+		}
+	}()
+
+	result := runSubmitted(ctx, string(program), input, wsOutput{conn}, serverLimits(*flagServeSessionTimeout).lower(limits))
+	input.Close()
+	status, err := json.Marshal(struct {
+		serveResult
+		// Sent already
+		Output string `json:"output,omitempty"`
+	}{serveResult: result})
+	if err == nil {
+		conn.WriteMessage(wsText, status)
+	}
+	conn.Close(wsCloseNormal, "")
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+// checkStrict returns an error pointing at the first byte in source that is
+// neither an instruction nor whitespace.
+func checkStrict(source []byte) error {
+	for i, b := range source {
+		switch {
+		case isProgramInstruction(b):
+		case b == ' ', b == '\t', b == '\r', b == '\n':
+		default:
+			line, column := sourcePosition(source, i)
+			return fmt.Errorf("%d:%d: unexpected character %q, only instructions and whitespace are allowed in strict mode", line, column, b)
+		}
+	}
+	return nil
+}
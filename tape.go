@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// formatTapeWindow renders the data cells within radius of the data pointer
+// as hexadecimal values, prefixed by the index of the first cell shown. The
+// cell at the data pointer is enclosed in brackets.
+func formatTapeWindow(p *bf.Processor, radius int) string {
+	start := p.DataPointer - radius
+	if start < 0 {
+		start = 0
+	}
+	end := p.DataPointer + radius + 1
+	if end > len(p.Data) {
+		end = len(p.Data)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%6d:", start)
+	for i := start; i < end; i++ {
+		if i == p.DataPointer {
+			fmt.Fprintf(&b, "[%02x]", p.Data[i])
+		} else {
+			fmt.Fprintf(&b, " %02x ", p.Data[i])
+		}
+	}
+	return b.String()
+}
+
+// describeState summarizes where execution of source currently is, followed by
+// the data cells around the data pointer on a separate line.
+func describeState(p *bf.Processor, source []byte) string {
+	position := "end of program"
+	if p.InstructionPointer() < len(source) {
+		line, column := sourcePosition(source, p.InstructionPointer())
+		position = fmt.Sprintf("%d:%d (%q)", line, column, p.Instruction())
+	}
+	return fmt.Sprintf("at %s after %d steps, data pointer %d\n%s",
+		position, p.Steps(), p.DataPointer, formatTapeWindow(p, 8))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/icedream/gobfy/bf"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Spans are dropped unless --otel sets up exporting them.
+var tracer = otel.Tracer("github.com/icedream/gobfy")
+
+// traceContext holds the span of the command being run, for the spans of
+// its phases.
+var traceContext = context.Background()
+
+// finishTracing ends the span of the command and exports what has not been
+// exported yet. Needs to be called before exiting.
+var finishTracing = func() {}
+
+// setupTracing makes spans get exported over OTLP/HTTP, configured by the
+// standard OTEL_EXPORTER_OTLP_* environment variables, and starts the span of
+// command. With batch, spans get exported in the background instead of once
+// they end, which suits long-running commands.
+func setupTracing(command string, batch bool) error {
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return fmt.Errorf("--otel: %s", err)
+	}
+	export := sdktrace.WithSyncer(exporter)
+	if batch {
+		export = sdktrace.WithBatcher(exporter)
+	}
+	provider := sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(app.Name))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var span trace.Span
+	traceContext, span = tracer.Start(context.Background(), app.Name+" "+command)
+	finishTracing = func() {
+		span.End()
+		provider.Shutdown(context.Background())
+	}
+	return nil
+}
+
+// endSpan ends span, marking it as failed with err unless nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// executionAttributes describe the execution of a program on p.
+func executionAttributes(p *bf.Processor) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64("gobfy.steps", int64(p.Steps())),
+		attribute.Int("gobfy.tape_peak", len(p.Data)),
+	}
+}
+
+// statusRecorder remembers the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets the WebSocket endpoint take over the connection.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection can not be taken over")
+	}
+	return hijacker.Hijack()
+}
+
+// traceRequests starts a span for each request to handler, continuing the
+// trace of the client if it sent one.
+func traceRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethodKey.String(r.Method), semconv.HTTPTargetKey.String(r.URL.Path)))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(recorder.status))
+		if recorder.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// metadataCarrier gives access to gRPC metadata for propagating traces.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// startRPCSpan starts the span of a call to method, continuing the trace of
+// the client if it sent one.
+func startRPCSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+	return tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// tracedStream passes on the context of a span to stream handlers.
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// Interceptors starting a span for each gRPC call.
+var (
+	traceUnary = grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startRPCSpan(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	})
+	traceStream = grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startRPCSpan(stream.Context(), info.FullMethod)
+		err := handler(srv, tracedStream{stream, ctx})
+		endSpan(span, err)
+		return err
+	})
+)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+// Fault codes the trap extension puts in the current cell before running
+// the handler.
+const (
+	faultPointerUnderflow = 1 + iota
+	faultInput
+	faultOther = 0xff
+)
+
+// The trap extension lets programs recover from errors, such as moving the
+// data pointer left of the first cell, instead of having the interpreter
+// abort.
+var trap = &bf.Extension{
+	Name:        "trap",
+	Description: "Traps: ' installs the code up to the next ' as handler for errors, replacing the previous one. The handler runs with the current cell set to 1 after moving left of the first cell, 2 at the end of input and 255 after any other error, then execution continues after the failed instruction.",
+	New: func() (map[byte]func(p *bf.Processor) error, error) {
+		return map[byte]func(p *bf.Processor) error{
+			'\'': func(p *bf.Processor) error {
+				code := p.Instructions()
+				start := p.InstructionPointer() + 1
+				end := start
+				for end < len(code) && code[end] != '\'' {
+					end++
+				}
+				if end == len(code) {
+					return errors.New("trap handler is missing its closing '")
+				}
+				if _, err := matchBrackets(code[start:end]); err != nil {
+					return fmt.Errorf("trap handler: %s", err)
+				}
+				handler := append([]byte(nil), code[start:end]...)
+
+				p.Trap(func(p *bf.Processor, fault error) error {
+					code := faultOther
+					switch {
+					case fault == bf.ErrPointerUnderflow:
+						code = faultPointerUnderflow
+					case fault == io.EOF:
+						code = faultInput
+					}
+					p.Data[p.DataPointer] = byte(code)
+					p.CellWritten()
+					return p.Evaluate("trap", handler)
+				})
+				p.Jump(end)
+				return nil
+			},
+		}, nil
+	},
+}
+
+func init() {
+	bf.RegisterExtension(trap)
+}
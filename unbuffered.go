@@ -0,0 +1,18 @@
+package main
+
+import "io"
+
+// singleByteReader reads at most a single byte from r at a time, so that
+// readers buffering on top of it don't take more from r than gets used.
+// Input left over when the program halts then remains for whatever reads
+// from the same file next, such as the following command in a shell script.
+type singleByteReader struct {
+	r io.Reader
+}
+
+func (s singleByteReader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	return s.r.Read(b[:1])
+}
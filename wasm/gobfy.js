@@ -0,0 +1,73 @@
+// gobfy.js runs programs in the browser with gobfy built for WebAssembly:
+//
+//   GOOS=js GOARCH=wasm go build -o gobfy.wasm github.com/icedream/gobfy
+//
+// It needs wasm_exec.js from the same Go installation, found in
+// $(go env GOROOT)/lib/wasm, loaded before it. Programs run on the calling
+// thread, so a playground should run them in a Web Worker to stay responsive
+// while programs never halting run.
+//
+//   const gobfy = await loadGobfy("gobfy.wasm", ["--eof", "zero"]);
+//   gobfy.onOutput((chunk) => console.log(new TextDecoder().decode(chunk)));
+//   const result = gobfy.run(",[.,]", "hello");
+//
+//   const session = gobfy.start("+[>+<-]", "");
+//   let state = session.step();
+//   while (!state.halted) state = session.step(10);
+//
+// The flags passed along configure how programs run like on the command
+// line, such as --lang or --eof.
+(function (global) {
+	"use strict";
+
+	async function loadGobfy(url, flags) {
+		const go = new global.Go();
+		go.argv = ["gobfy"].concat(flags || []);
+		let exited = null;
+		go.exit = (code) => {
+			exited = code;
+		};
+
+		let source;
+		if (typeof url === "string" && typeof fetch === "function") {
+			source = await WebAssembly.instantiateStreaming(fetch(url), go.importObject);
+		} else {
+			source = await WebAssembly.instantiate(url, go.importObject);
+		}
+		go.run(source.instance);
+
+		const bindings = global.gobfy;
+		if (exited !== null || !bindings) {
+			throw new Error(`gobfy exited with status ${exited}`);
+		}
+		delete global.gobfy;
+
+		const listeners = [];
+		const emit = (chunk) => listeners.forEach((listener) => listener(chunk));
+		return {
+			// Registers listener to be called with output as Uint8Array as it is
+			// produced, instead of results holding it.
+			onOutput(listener) {
+				listeners.push(listener);
+			},
+			// Runs program with the given input, a string or Uint8Array, to its
+			// end and returns its result.
+			run(program, input) {
+				return bindings.run(program, input || "", listeners.length ? emit : undefined);
+			},
+			// Returns a session with program paused before its first
+			// instruction. step(n = 1) executes n instructions, run() continues
+			// to the end and stop() stops the program, each returning its state
+			// or its result once halted.
+			start(program, input) {
+				return bindings.start(program, input || "", listeners.length ? emit : undefined);
+			},
+		};
+	}
+
+	if (typeof module !== "undefined" && module.exports) {
+		module.exports = loadGobfy;
+	} else {
+		global.loadGobfy = loadGobfy;
+	}
+})(globalThis);
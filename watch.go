@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/icedream/gobfy/bf"
+)
+
+const (
+	watchPollInterval = 100 * time.Millisecond
+	// Changes need to settle for this long before the program gets run
+	// again, editors tend to write files in several steps.
+	watchDebounce = 300 * time.Millisecond
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(paths []string) map[string]fileState {
+	states := map[string]fileState{}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			states[path] = fileState{info.ModTime(), info.Size()}
+		}
+	}
+	return states
+}
+
+func sameFileStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, state := range a {
+		if b[path] != state {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForChange blocks until any of the files at paths differs from states
+// and has settled. Returns false if given up on because done got closed.
+func waitForChange(paths []string, states map[string]fileState, done <-chan struct{}) bool {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	var lastChange time.Time
+	for {
+		select {
+		case <-done:
+			return false
+		case now := <-ticker.C:
+			current := statFiles(paths)
+			if !sameFileStates(current, states) {
+				states = current
+				lastChange = now
+			} else if !lastChange.IsZero() && now.Sub(lastChange) >= watchDebounce {
+				return true
+			}
+		}
+	}
+}
+
+var (
+	// Closed once the source files changed, while watching
+	watchChanged <-chan struct{}
+	// Standard input while watching, shared by all runs
+	watchedInput *backgroundReader
+)
+
+// watchInput returns stdin read in the background, so that a program
+// waiting for input gets stopped once the source files change. Input read
+// ahead of a program stopped that way is left for the next run.
+func watchInput(stdin io.Reader) io.Reader {
+	if watchedInput == nil {
+		watchedInput = newBackgroundReader(stdin)
+	}
+	watchedInput.cancel = watchChanged
+	return watchedInput
+}
+
+// watch runs the program from the source files at paths, then runs it again
+// whenever any of them changes. A program still running at that point gets
+// stopped first.
+func watch(paths []string, withDebugger bool) {
+	if *flagExecute != "" || len(paths) == 0 {
+		app.Fatalf("--watch needs source files to watch")
+	}
+	for _, path := range paths {
+		if path == stdinPath || isURL(path) {
+			app.Fatalf("--watch can only watch local source files")
+		}
+	}
+
+	for {
+		states := statFiles(paths)
+		changed := make(chan struct{})
+		watchChanged = changed
+		done := make(chan struct{})
+		go func() {
+			if waitForChange(paths, states, done) {
+				close(changed)
+			}
+		}()
+
+		if source, err := loadProgram(paths); err != nil {
+			log.Print(err)
+		} else {
+			p := newProcessor()
+			go func() {
+				select {
+				case <-changed:
+					p.Stop()
+				case <-done:
+				}
+			}()
+
+			err := run(p, source, withDebugger)
+			select {
+			case <-changed:
+				// Stopped to restart
+			default:
+				if errors.Is(err, bf.ErrInterrupted) {
+					fmt.Fprintf(diagnostics(), "\ninterrupted: %s\n", describeState(p, source))
+					close(done)
+					os.Exit(130)
+				}
+				if err != nil {
+					log.Print(err)
+				}
+				fmt.Fprintln(diagnostics(), "\n--- program halted, waiting for changes ---")
+			}
+		}
+
+		<-changed
+		close(done)
+		fmt.Fprintf(diagnostics(), "\n--- %s: source changed, restarting ---\n", time.Now().Format("15:04:05"))
+	}
+}
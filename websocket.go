@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WebSocket opcodes, see RFC 6455.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// Status codes of WebSocket close frames.
+const (
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseTooBig      = 1009
+	wsCloseInternalErr = 1011
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	errWebSocketTooBig = errors.New("websocket message too big")
+	errWebSocketOrigin = errors.New("websocket connections from pages of this origin are not allowed")
+)
+
+// wsConn is the server side of a WebSocket connection, enough of RFC 6455
+// to exchange messages with browsers.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	// Maximum size of messages read
+	maxSize int64
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// upgradeWebSocket takes over the connection of a WebSocket handshake
+// request, responding to it. Fails with errWebSocketOrigin for requests by
+// pages of origins other than the server's and allowedOrigins.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, maxSize int64, allowedOrigins []string) (*wsConn, error) {
+	if !originAllowed(r, allowedOrigins) {
+		return nil, errWebSocketOrigin
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("expected WebSocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, fmt.Errorf("unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing Sec-WebSocket-Key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection can not be taken over for WebSocket")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, rw: rw, maxSize: maxSize}, nil
+}
+
+// originAllowed tells whether r is by a page of the same host as the server,
+// of one of the allowed origins, or not by a page in a browser at all, which
+// browsers tell by the Origin header. Browsers let pages connect to any
+// WebSocket server, which would let any page use the server on behalf of
+// its visitors otherwise.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContains tells whether the comma-separated values of the header
+// name contain value, ignoring case.
+func headerContains(header http.Header, name, value string) bool {
+	for _, line := range header[name] {
+		for _, v := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings in
+// between. Returns io.EOF once the client closed the connection.
+func (c *wsConn) ReadMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.Close(wsCloseNormal, "")
+			return 0, nil, io.EOF
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return 0, nil, c.fail(wsCloseProtocol, "expected continuation frame")
+			}
+			opcode = op
+		case wsContinuation:
+			if opcode == 0 {
+				return 0, nil, c.fail(wsCloseProtocol, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(wsCloseProtocol, fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if int64(len(message)+len(payload)) > c.maxSize {
+			c.Close(wsCloseTooBig, "")
+			return 0, nil, errWebSocketTooBig
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.rw, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0f
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(wsCloseProtocol, "client frames need to be masked")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if length < 0 || length > c.maxSize {
+		c.Close(wsCloseTooBig, "")
+		return false, 0, nil, errWebSocketTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends message as a single frame, opcode telling whether it
+// is text or binary.
+func (c *wsConn) WriteMessage(opcode byte, message []byte) error {
+	return c.writeFrame(opcode, message)
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126, byte(length>>8), byte(length))
+	default:
+		header = append(header, 127)
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	if err := c.rw.Flush(); err != nil {
+		return err
+	}
+	if opcode == wsClose {
+		c.closed = true
+	}
+	return nil
+}
+
+// fail closes the connection for a protocol violation by the client.
+func (c *wsConn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return errors.New(reason)
+}
+
+// Close sends a close frame with code and reason unless sent already, and
+// closes the connection.
+func (c *wsConn) Close(code int, reason string) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := append([]byte{byte(code >> 8), byte(code)}, reason...)
+	c.writeFrame(wsClose, payload)
+	return c.conn.Close()
+}
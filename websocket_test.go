@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// wsFrame encodes a frame the way clients send them, masked unless told
+// otherwise.
+func wsFrame(fin bool, opcode byte, payload []byte, masked bool) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+type wsTestFrame struct {
+	opcode  byte
+	payload []byte
+}
+
+// readWSFrames decodes the unmasked frames sent by the server.
+func readWSFrames(t *testing.T, data []byte) []wsTestFrame {
+	var frames []wsTestFrame
+	for len(data) > 0 {
+		if len(data) < 2 || data[1]&0x80 != 0 {
+			t.Fatalf("invalid frame sent by the server: %x", data)
+		}
+		opcode, length := data[0]&0x0f, int(data[1])
+		data = data[2:]
+		switch length {
+		case 126:
+			length, data = int(binary.BigEndian.Uint16(data)), data[2:]
+		case 127:
+			length, data = int(binary.BigEndian.Uint64(data)), data[8:]
+		}
+		frames = append(frames, wsTestFrame{opcode, data[:length]})
+		data = data[length:]
+	}
+	return frames
+}
+
+// newTestWSConn returns the server side of a WebSocket connection and the
+// client's end of it.
+func newTestWSConn(maxSize int64) (*wsConn, net.Conn) {
+	server, client := net.Pipe()
+	rw := bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))
+	return &wsConn{conn: server, rw: rw, maxSize: maxSize}, client
+}
+
+func TestWSConnReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		frames  [][]byte
+		opcode  byte
+		message string
+		err     error
+		// Fails with an error of its own
+		fails bool
+		// Frames sent back by the server
+		sent []wsTestFrame
+	}{
+		{
+			name:    "text",
+			frames:  [][]byte{wsFrame(true, wsText, []byte("hello"), true)},
+			opcode:  wsText,
+			message: "hello",
+		},
+		{
+			name:    "binary",
+			frames:  [][]byte{wsFrame(true, wsBinary, []byte{0, 1, 255}, true)},
+			opcode:  wsBinary,
+			message: "\x00\x01\xff",
+		},
+		{
+			name:    "empty",
+			frames:  [][]byte{wsFrame(true, wsText, nil, true)},
+			opcode:  wsText,
+			message: "",
+		},
+		{
+			name:    "16-bit length",
+			frames:  [][]byte{wsFrame(true, wsBinary, bytes.Repeat([]byte("x"), 300), true)},
+			opcode:  wsBinary,
+			message: string(bytes.Repeat([]byte("x"), 300)),
+		},
+		{
+			name:    "64-bit length",
+			maxSize: 70000,
+			frames:  [][]byte{wsFrame(true, wsBinary, bytes.Repeat([]byte("y"), 66000), true)},
+			opcode:  wsBinary,
+			message: string(bytes.Repeat([]byte("y"), 66000)),
+		},
+		{
+			name: "fragmented",
+			frames: [][]byte{
+				wsFrame(false, wsText, []byte("hel"), true),
+				wsFrame(false, wsContinuation, []byte("l"), true),
+				wsFrame(true, wsContinuation, []byte("o"), true),
+			},
+			opcode:  wsText,
+			message: "hello",
+		},
+		{
+			name: "ping between fragments",
+			frames: [][]byte{
+				wsFrame(false, wsText, []byte("hel"), true),
+				wsFrame(true, wsPing, []byte("are you there"), true),
+				wsFrame(true, wsContinuation, []byte("lo"), true),
+			},
+			opcode:  wsText,
+			message: "hello",
+			sent:    []wsTestFrame{{wsPong, []byte("are you there")}},
+		},
+		{
+			name: "pong ignored",
+			frames: [][]byte{
+				wsFrame(true, wsPong, nil, true),
+				wsFrame(true, wsText, []byte("hi"), true),
+			},
+			opcode:  wsText,
+			message: "hi",
+		},
+		{
+			name:   "close",
+			frames: [][]byte{wsFrame(true, wsClose, []byte{0x03, 0xe8}, true)},
+			err:    io.EOF,
+			sent:   []wsTestFrame{{wsClose, []byte{0x03, 0xe8}}},
+		},
+		{
+			name:   "unmasked",
+			frames: [][]byte{wsFrame(true, wsText, []byte("hello"), false)},
+			fails:  true,
+			sent:   []wsTestFrame{{wsClose, []byte("\x03\xeaclient frames need to be masked")}},
+		},
+		{
+			name:    "oversize frame",
+			maxSize: 4,
+			frames:  [][]byte{wsFrame(true, wsText, []byte("hello"), true)},
+			err:     errWebSocketTooBig,
+			sent:    []wsTestFrame{{wsClose, []byte{0x03, 0xf1}}},
+		},
+		{
+			name:    "oversize message",
+			maxSize: 4,
+			frames: [][]byte{
+				wsFrame(false, wsText, []byte("hel"), true),
+				wsFrame(true, wsContinuation, []byte("lo"), true),
+			},
+			err:  errWebSocketTooBig,
+			sent: []wsTestFrame{{wsClose, []byte{0x03, 0xf1}}},
+		},
+		{
+			name:   "unexpected continuation",
+			frames: [][]byte{wsFrame(true, wsContinuation, []byte("lo"), true)},
+			fails:  true,
+			sent:   []wsTestFrame{{wsClose, []byte("\x03\xeaunexpected continuation frame")}},
+		},
+		{
+			name: "missing continuation",
+			frames: [][]byte{
+				wsFrame(false, wsText, []byte("hel"), true),
+				wsFrame(true, wsText, []byte("lo"), true),
+			},
+			fails: true,
+			sent:  []wsTestFrame{{wsClose, []byte("\x03\xeaexpected continuation frame")}},
+		},
+		{
+			name:   "unknown opcode",
+			frames: [][]byte{wsFrame(true, 0x3, nil, true)},
+			fails:  true,
+			sent:   []wsTestFrame{{wsClose, []byte("\x03\xeaunknown opcode 3")}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maxSize := test.maxSize
+			if maxSize == 0 {
+				maxSize = 1024
+			}
+			c, client := newTestWSConn(maxSize)
+			go client.Write(bytes.Join(test.frames, nil))
+			sent := make(chan []byte)
+			go func() {
+				data, _ := ioutil.ReadAll(client)
+				sent <- data
+			}()
+
+			opcode, message, err := c.ReadMessage()
+			c.conn.Close()
+			switch {
+			case test.fails && err == nil:
+				t.Errorf("expected an error, got message %q", message)
+			case !test.fails && err != test.err:
+				t.Errorf("got error %v, expected %v", err, test.err)
+			}
+			if opcode != test.opcode || string(message) != test.message {
+				t.Errorf("got message %q with opcode %d, expected %q with opcode %d", message, opcode, test.message, test.opcode)
+			}
+
+			frames := readWSFrames(t, <-sent)
+			if len(frames) != len(test.sent) {
+				t.Fatalf("server sent %v, expected %v", frames, test.sent)
+			}
+			for i, frame := range frames {
+				if frame.opcode != test.sent[i].opcode || !bytes.Equal(frame.payload, test.sent[i].payload) {
+					t.Errorf("server sent frame with opcode %d and payload %q, expected opcode %d and payload %q",
+						frame.opcode, frame.payload, test.sent[i].opcode, test.sent[i].payload)
+				}
+			}
+		})
+	}
+}
+
+func TestWSConnWriteMessage(t *testing.T) {
+	for _, length := range []int{0, 125, 126, 0xffff, 0x10000} {
+		c, client := newTestWSConn(1024)
+		payload := bytes.Repeat([]byte("z"), length)
+		go func() {
+			c.WriteMessage(wsBinary, payload)
+			c.conn.Close()
+		}()
+		data, _ := ioutil.ReadAll(client)
+		frames := readWSFrames(t, data)
+		if len(frames) != 1 || frames[0].opcode != wsBinary || !bytes.Equal(frames[0].payload, payload) {
+			t.Errorf("message of %d bytes sent wrongly: %x", length, data[:10])
+		}
+	}
+}
+
+func TestWSConnClosed(t *testing.T) {
+	c, client := newTestWSConn(1024)
+	go ioutil.ReadAll(client)
+	c.Close(wsCloseNormal, "")
+	if err := c.WriteMessage(wsText, []byte("late")); err != net.ErrClosed {
+		t.Errorf("writing after closing failed with %v, expected %v", err, net.ErrClosed)
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		origin  string
+		host    string
+		allowed []string
+		ok      bool
+	}{
+		{"", "localhost:8080", nil, true},
+		{"http://localhost:8080", "localhost:8080", nil, true},
+		{"https://LOCALHOST:8080", "localhost:8080", nil, true},
+		{"http://localhost:8081", "localhost:8080", nil, false},
+		{"https://evil.example", "localhost:8080", nil, false},
+		{"null", "localhost:8080", nil, false},
+		{"https://example.com", "localhost:8080", []string{"https://example.com"}, true},
+		{"https://example.com", "localhost:8080", []string{"https://example.com/"}, true},
+		{"http://example.com", "localhost:8080", []string{"https://example.com"}, false},
+		{"https://evil.example", "localhost:8080", []string{"*"}, true},
+	}
+	for _, test := range tests {
+		r := &http.Request{Host: test.host, Header: http.Header{}}
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if ok := originAllowed(r, test.allowed); ok != test.ok {
+			t.Errorf("origin %q for host %s with %v allowed: got %v, expected %v", test.origin, test.host, test.allowed, ok, test.ok)
+		}
+	}
+}